@@ -0,0 +1,90 @@
+package acomm
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/cerana/cerana/pkg/errors"
+)
+
+// FileStore is an OperationStore that persists each Operation as one JSON
+// file in a directory, so a coordinator restart can reload in-flight work
+// instead of silently losing it.
+type FileStore struct {
+	dir string
+}
+
+// NewFileStore creates a FileStore rooted at dir, creating it if it doesn't
+// already exist.
+func NewFileStore(dir string) (*FileStore, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, errors.Wrapv(err, map[string]interface{}{"dir": dir})
+	}
+	return &FileStore{dir: dir}, nil
+}
+
+// NewTrackerStore creates a FileStore that persists Operations alongside
+// the given Tracker, in an "operations" subdirectory next to the Tracker's
+// own address. Passing the resulting store to NewOperationManager gives
+// Operations the same restart-survives guarantee the Tracker already gives
+// its own tracked requests.
+func NewTrackerStore(tracker *Tracker) (*FileStore, error) {
+	dir := filepath.Join(filepath.Dir(tracker.URL().Path), "operations")
+	return NewFileStore(dir)
+}
+
+// SaveOperation writes op to its own file in the store's directory,
+// overwriting any previous save for the same ID.
+func (s *FileStore) SaveOperation(op *Operation) error {
+	data, err := json.Marshal(op)
+	if err != nil {
+		return errors.Wrapv(err, map[string]interface{}{"id": op.ID})
+	}
+	if err := ioutil.WriteFile(s.path(op.ID), data, 0644); err != nil {
+		return errors.Wrapv(err, map[string]interface{}{"id": op.ID})
+	}
+	return nil
+}
+
+// DeleteOperation removes the file previously saved for id, if any. It is a
+// no-op if no file exists for id, so callers don't need to track whether a
+// given Operation was ever actually persisted.
+func (s *FileStore) DeleteOperation(id string) error {
+	if err := os.Remove(s.path(id)); err != nil && !os.IsNotExist(err) {
+		return errors.Wrapv(err, map[string]interface{}{"id": id})
+	}
+	return nil
+}
+
+// LoadOperations reads every Operation previously saved in the store's
+// directory.
+func (s *FileStore) LoadOperations() ([]*Operation, error) {
+	entries, err := ioutil.ReadDir(s.dir)
+	if err != nil {
+		return nil, errors.Wrapv(err, map[string]interface{}{"dir": s.dir})
+	}
+
+	var ops []*Operation
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".json") {
+			continue
+		}
+		data, err := ioutil.ReadFile(filepath.Join(s.dir, entry.Name()))
+		if err != nil {
+			return nil, errors.Wrapv(err, map[string]interface{}{"file": entry.Name()})
+		}
+		var op Operation
+		if err := json.Unmarshal(data, &op); err != nil {
+			return nil, errors.Wrapv(err, map[string]interface{}{"file": entry.Name()})
+		}
+		ops = append(ops, &op)
+	}
+	return ops, nil
+}
+
+func (s *FileStore) path(id string) string {
+	return filepath.Join(s.dir, id+".json")
+}
@@ -0,0 +1,81 @@
+package acomm
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFileStoreSaveAndLoad(t *testing.T) {
+	dir, err := ioutil.TempDir("", "acomm-file-store")
+	assert.NoError(t, err)
+	defer func() { _ = os.RemoveAll(dir) }()
+
+	store, err := NewFileStore(dir)
+	assert.NoError(t, err)
+
+	op := &Operation{ID: "op-1", State: OperationRunning, Metadata: map[string]interface{}{"k": "v"}}
+	assert.NoError(t, store.SaveOperation(op))
+
+	loaded, err := store.LoadOperations()
+	assert.NoError(t, err)
+	if assert.Len(t, loaded, 1) {
+		assert.Equal(t, op.ID, loaded[0].ID)
+		assert.Equal(t, op.State, loaded[0].State)
+		assert.Equal(t, op.Metadata, loaded[0].Metadata)
+	}
+}
+
+func TestFileStoreSaveOverwrites(t *testing.T) {
+	dir, err := ioutil.TempDir("", "acomm-file-store")
+	assert.NoError(t, err)
+	defer func() { _ = os.RemoveAll(dir) }()
+
+	store, err := NewFileStore(dir)
+	assert.NoError(t, err)
+
+	assert.NoError(t, store.SaveOperation(&Operation{ID: "op-1", State: OperationRunning}))
+	assert.NoError(t, store.SaveOperation(&Operation{ID: "op-1", State: OperationSuccess}))
+
+	loaded, err := store.LoadOperations()
+	assert.NoError(t, err)
+	if assert.Len(t, loaded, 1) {
+		assert.Equal(t, OperationSuccess, loaded[0].State)
+	}
+}
+
+func TestFileStoreDeleteOperation(t *testing.T) {
+	dir, err := ioutil.TempDir("", "acomm-file-store")
+	assert.NoError(t, err)
+	defer func() { _ = os.RemoveAll(dir) }()
+
+	store, err := NewFileStore(dir)
+	assert.NoError(t, err)
+
+	assert.NoError(t, store.SaveOperation(&Operation{ID: "op-1", State: OperationRunning}))
+	assert.NoError(t, store.DeleteOperation("op-1"))
+
+	loaded, err := store.LoadOperations()
+	assert.NoError(t, err)
+	assert.Empty(t, loaded)
+
+	// Deleting an ID with no saved file is a no-op, not an error.
+	assert.NoError(t, store.DeleteOperation("never-saved"))
+}
+
+func TestNewFileStoreCreatesDir(t *testing.T) {
+	parent, err := ioutil.TempDir("", "acomm-file-store")
+	assert.NoError(t, err)
+	defer func() { _ = os.RemoveAll(parent) }()
+
+	dir := filepath.Join(parent, "nested", "operations")
+	_, err = NewFileStore(dir)
+	assert.NoError(t, err)
+
+	info, err := os.Stat(dir)
+	assert.NoError(t, err)
+	assert.True(t, info.IsDir())
+}
@@ -0,0 +1,196 @@
+package acomm
+
+import (
+	"fmt"
+	"math/rand"
+	"net/url"
+	"time"
+)
+
+// RequestResult is the outcome of one named sub-request within a
+// MultiRequest.
+type RequestResult struct {
+	Name     string        `json:"name"`
+	Response *Response     `json:"response,omitempty"`
+	Error    error         `json:"error,omitempty"`
+	Latency  time.Duration `json:"latency"`
+}
+
+// MultiResult is the aggregate outcome of a MultiRequest. Unlike treating
+// any sub-request error as fatal to the whole batch, every sub-request
+// that was sent gets a RequestResult here, so a caller can keep applying
+// the successful subset while surfacing the failed subset for retry.
+type MultiResult struct {
+	Results map[string]*RequestResult
+}
+
+// Succeeded returns the names of sub-requests that completed without
+// error.
+func (r *MultiResult) Succeeded() []string {
+	names := make([]string, 0, len(r.Results))
+	for name, result := range r.Results {
+		if result.Error == nil {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// Failed returns the names of sub-requests that errored.
+func (r *MultiResult) Failed() []string {
+	names := make([]string, 0, len(r.Results))
+	for name, result := range r.Results {
+		if result.Error != nil {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// PartialFailure is returned by RunMultiRequest when some, but not all,
+// sub-requests failed. Callers can type-assert for it to decide whether to
+// proceed with the successful subset instead of failing the whole batch.
+type PartialFailure struct {
+	*MultiResult
+}
+
+// Error implements error.
+func (e *PartialFailure) Error() string {
+	return fmt.Sprintf("%d of %d sub-requests failed", len(e.Failed()), len(e.Results))
+}
+
+// RetryPolicy configures transparent retry of failed sub-requests within a
+// MultiRequest.
+type RetryPolicy struct {
+	// MaxAttempts is the total number of times a sub-request is sent,
+	// including the first attempt. Zero or one disables retries.
+	MaxAttempts int
+	// Backoff is the base delay between attempts.
+	Backoff time.Duration
+	// Jitter is a random amount, up to this duration, added to Backoff.
+	Jitter time.Duration
+}
+
+func (p *RetryPolicy) maxAttempts() int {
+	if p == nil || p.MaxAttempts < 1 {
+		return 1
+	}
+	return p.MaxAttempts
+}
+
+func (p *RetryPolicy) delay() time.Duration {
+	if p == nil {
+		return 0
+	}
+	d := p.Backoff
+	if p.Jitter > 0 {
+		d += time.Duration(rand.Int63n(int64(p.Jitter)))
+	}
+	return d
+}
+
+// RunMultiRequest builds and sends one request per name in options to
+// destURL via multiRequest, waits for every response, and returns a
+// MultiResult covering all of them. If policy allows retries, a
+// sub-request that errored is rebuilt from its RequestOptions -- a genuine
+// fresh Request, with its own new ID -- and resent, up to
+// policy.MaxAttempts times, before being recorded as failed.
+//
+// The returned error is nil if every sub-request succeeded, a
+// *PartialFailure if some but not all succeeded, and a plain error
+// wrapping the last failure if every sub-request failed.
+func RunMultiRequest(multiRequest *MultiRequest, destURL *url.URL, options map[string]RequestOptions, policy *RetryPolicy) (*MultiResult, error) {
+	result := &MultiResult{Results: make(map[string]*RequestResult, len(options))}
+	pending := options
+
+	for attempt := 1; attempt <= policy.maxAttempts() && len(pending) > 0; attempt++ {
+		if attempt > 1 {
+			time.Sleep(policy.delay())
+		}
+
+		sent := make(map[string]time.Time, len(pending))
+		sendErrs := make(map[string]error)
+		for name, opt := range pending {
+			req, err := NewRequest(opt)
+			if err != nil {
+				sendErrs[name] = err
+				continue
+			}
+			if err := multiRequest.AddRequest(name, req); err != nil {
+				sendErrs[name] = err
+				continue
+			}
+			sent[name] = time.Now()
+			if err := Send(destURL, req); err != nil {
+				multiRequest.RemoveRequest(req)
+				delete(sent, name)
+				sendErrs[name] = err
+			}
+		}
+
+		responses := multiRequest.Responses()
+		next := make(map[string]RequestOptions)
+		for name := range pending {
+			// A sub-request that never made it out (NewRequest/AddRequest/Send
+			// itself errored) gets the same retry treatment as one that was
+			// sent but got an error response -- classifyResponse on a nil
+			// response already maps to "no response received".
+			var resp *Response
+			var latency time.Duration
+			if err, failed := sendErrs[name]; failed {
+				resp = &Response{Error: err}
+			} else {
+				resp = responses[name]
+				latency = time.Since(sent[name])
+			}
+			outcome, retry := classifyResponse(name, resp, latency, attempt, policy.maxAttempts())
+			if retry {
+				next[name] = pending[name]
+				continue
+			}
+			result.Results[name] = outcome
+		}
+		pending = next
+	}
+
+	return result, result.finalError()
+}
+
+// classifyResponse decides the RequestResult for one sub-request's response
+// on a given attempt. It returns retry=true, with a nil result, when the
+// sub-request errored and there are attempts left to try again.
+func classifyResponse(name string, resp *Response, latency time.Duration, attempt, maxAttempts int) (result *RequestResult, retry bool) {
+	if resp != nil && resp.Error == nil {
+		return &RequestResult{Name: name, Response: resp, Latency: latency}, false
+	}
+
+	respErr := resp.getError()
+	if attempt < maxAttempts {
+		return nil, true
+	}
+	return &RequestResult{Name: name, Response: resp, Error: respErr, Latency: latency}, false
+}
+
+// getError returns resp.Error, or a stand-in error if resp itself is nil
+// (no response was ever received for the sub-request).
+func (resp *Response) getError() error {
+	if resp == nil {
+		return fmt.Errorf("no response received")
+	}
+	return resp.Error
+}
+
+// finalError computes RunMultiRequest's return error from a completed
+// MultiResult: nil if everything succeeded, a *PartialFailure if some but
+// not all did, and a plain error wrapping the last failure if everything
+// failed.
+func (r *MultiResult) finalError() error {
+	failed := r.Failed()
+	if len(failed) == 0 {
+		return nil
+	}
+	if len(failed) == len(r.Results) {
+		return fmt.Errorf("all %d sub-requests failed, e.g. %q: %v", len(failed), failed[0], r.Results[failed[0]].Error)
+	}
+	return &PartialFailure{MultiResult: r}
+}
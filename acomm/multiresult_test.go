@@ -0,0 +1,78 @@
+package acomm
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClassifyResponse(t *testing.T) {
+	tests := []struct {
+		name        string
+		resp        *Response
+		attempt     int
+		maxAttempts int
+		wantRetry   bool
+		wantErr     bool
+	}{
+		{"success", &Response{}, 1, 3, false, false},
+		{"error with attempts left retries", &Response{Error: fmt.Errorf("boom")}, 1, 3, true, false},
+		{"error on last attempt fails", &Response{Error: fmt.Errorf("boom")}, 3, 3, false, true},
+		{"no response on last attempt fails", nil, 1, 1, false, true},
+		{"no response with attempts left retries", nil, 1, 3, true, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			result, retry := classifyResponse("name", test.resp, time.Second, test.attempt, test.maxAttempts)
+			assert.Equal(t, test.wantRetry, retry)
+			if test.wantRetry {
+				assert.Nil(t, result)
+				return
+			}
+			assert.NotNil(t, result)
+			assert.Equal(t, test.wantErr, result.Error != nil)
+		})
+	}
+}
+
+func TestMultiResultFinalError(t *testing.T) {
+	t.Run("all succeeded", func(t *testing.T) {
+		result := &MultiResult{Results: map[string]*RequestResult{
+			"a": {Name: "a"},
+			"b": {Name: "b"},
+		}}
+		assert.NoError(t, result.finalError())
+	})
+
+	t.Run("some failed is a PartialFailure", func(t *testing.T) {
+		result := &MultiResult{Results: map[string]*RequestResult{
+			"a": {Name: "a"},
+			"b": {Name: "b", Error: fmt.Errorf("boom")},
+		}}
+		err := result.finalError()
+		partial, ok := err.(*PartialFailure)
+		if assert.True(t, ok, "expected *PartialFailure, got %T", err) {
+			assert.Equal(t, []string{"a"}, partial.Succeeded())
+			assert.Equal(t, []string{"b"}, partial.Failed())
+		}
+	})
+
+	t.Run("all failed is a plain error", func(t *testing.T) {
+		result := &MultiResult{Results: map[string]*RequestResult{
+			"a": {Name: "a", Error: fmt.Errorf("boom")},
+		}}
+		err := result.finalError()
+		assert.Error(t, err)
+		_, ok := err.(*PartialFailure)
+		assert.False(t, ok, "did not expect *PartialFailure when everything failed")
+	})
+}
+
+func TestRetryPolicyMaxAttempts(t *testing.T) {
+	assert.Equal(t, 1, (*RetryPolicy)(nil).maxAttempts())
+	assert.Equal(t, 1, (&RetryPolicy{}).maxAttempts())
+	assert.Equal(t, 5, (&RetryPolicy{MaxAttempts: 5}).maxAttempts())
+}
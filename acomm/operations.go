@@ -0,0 +1,357 @@
+package acomm
+
+import (
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/cerana/cerana/pkg/errors"
+	"github.com/cerana/cerana/provider"
+	"github.com/pborman/uuid"
+)
+
+// OperationState is the lifecycle state of a long-running Operation.
+type OperationState string
+
+// Possible OperationStates.
+const (
+	OperationPending   OperationState = "pending"
+	OperationRunning   OperationState = "running"
+	OperationSuccess   OperationState = "success"
+	OperationFailure   OperationState = "failure"
+	OperationCancelled OperationState = "cancelled"
+)
+
+// Operation is a handle to long-running provider work. Instead of blocking
+// a task response on completion, a handler can create an Operation, kick
+// off the work in a goroutine, and return the Operation so the caller can
+// poll, subscribe to progress, or cancel it via the operation-wait,
+// operation-get, and operation-cancel tasks.
+type Operation struct {
+	ID        string                 `json:"id"`
+	State     OperationState         `json:"state"`
+	Metadata  map[string]interface{} `json:"metadata"`
+	Result    interface{}            `json:"result,omitempty"`
+	Err       string                 `json:"error,omitempty"`
+	CreatedAt time.Time              `json:"createdAt"`
+	UpdatedAt time.Time              `json:"updatedAt"`
+
+	mu       sync.Mutex
+	cancel   func()
+	watchers []chan *Operation
+	manager  *OperationManager
+}
+
+// OperationEvent is a snapshot of an Operation sent to watchers whenever it
+// changes.
+type OperationEvent struct {
+	Operation
+}
+
+// OperationStore persists Operation state so that a coordinator restart
+// doesn't lose track of in-flight work. A FileStore (see NewFileStore and
+// NewTrackerStore) can be passed to NewOperationManager to enable
+// persistence.
+type OperationStore interface {
+	SaveOperation(*Operation) error
+	LoadOperations() ([]*Operation, error)
+	DeleteOperation(id string) error
+}
+
+// OperationManager tracks the set of in-flight Operations.
+type OperationManager struct {
+	mu    sync.Mutex
+	byID  map[string]*Operation
+	store OperationStore
+}
+
+// NewOperationManager creates an OperationManager. store may be nil, in
+// which case Operations are only tracked in memory and do not survive a
+// restart.
+func NewOperationManager(store OperationStore) (*OperationManager, error) {
+	m := &OperationManager{
+		byID:  make(map[string]*Operation),
+		store: store,
+	}
+
+	if store == nil {
+		return m, nil
+	}
+
+	existing, err := store.LoadOperations()
+	if err != nil {
+		return nil, errors.Wrapv(err, map[string]interface{}{})
+	}
+	for _, op := range existing {
+		op.manager = m
+		m.byID[op.ID] = op
+	}
+	return m, nil
+}
+
+// New creates and tracks a new Operation in the pending state. cancel, if
+// non-nil, is invoked when the Operation is cancelled.
+func (m *OperationManager) New(cancel func()) *Operation {
+	now := time.Now()
+	op := &Operation{
+		ID:        uuid.New(),
+		State:     OperationPending,
+		Metadata:  make(map[string]interface{}),
+		CreatedAt: now,
+		UpdatedAt: now,
+		cancel:    cancel,
+		manager:   m,
+	}
+
+	m.mu.Lock()
+	m.byID[op.ID] = op
+	m.mu.Unlock()
+
+	m.persist(op)
+	return op
+}
+
+// Get returns the Operation with the given ID, or nil if it isn't tracked.
+func (m *OperationManager) Get(id string) *Operation {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.byID[id]
+}
+
+// persist saves op to the store, unless op has reached a terminal state, in
+// which case it deletes op's persisted copy instead: a completed Operation
+// no longer needs to be recoverable after a restart, so keeping its file
+// around would just grow the store's directory without bound over the life
+// of a long-running coordinator.
+func (m *OperationManager) persist(op *Operation) {
+	if m.store == nil {
+		return
+	}
+	if isTerminal(op.State) {
+		_ = m.store.DeleteOperation(op.ID)
+		return
+	}
+	_ = m.store.SaveOperation(op)
+}
+
+// Forget removes the Operation with the given ID from the manager, so it's
+// no longer returned by Get. Use it once an Operation's result no longer
+// needs to be queryable -- e.g. a long-lived subscription whose caller has
+// drained every event it produced -- so it doesn't sit in memory forever.
+func (m *OperationManager) Forget(id string) {
+	m.mu.Lock()
+	delete(m.byID, id)
+	m.mu.Unlock()
+}
+
+// Running marks the Operation as running.
+func (o *Operation) Running() {
+	o.update(func() { o.State = OperationRunning })
+}
+
+// Progress merges fields into the Operation's metadata and notifies
+// watchers, without changing its state.
+func (o *Operation) Progress(metadata map[string]interface{}) {
+	o.update(func() {
+		for k, v := range metadata {
+			o.Metadata[k] = v
+		}
+	})
+}
+
+// Succeed marks the Operation successful with the given result. It is a
+// no-op if the Operation has already reached a terminal state.
+func (o *Operation) Succeed(result interface{}) {
+	if !o.finish(func() {
+		o.State = OperationSuccess
+		o.Result = result
+	}) {
+		return
+	}
+	o.closeWatchers()
+}
+
+// Fail marks the Operation failed with the given error. It is a no-op if
+// the Operation has already reached a terminal state (e.g. it was
+// cancelled while the work it guarded was tearing down).
+func (o *Operation) Fail(err error) {
+	if !o.finish(func() {
+		o.State = OperationFailure
+		o.Err = err.Error()
+	}) {
+		return
+	}
+	o.closeWatchers()
+}
+
+// Cancel requests cancellation of the Operation. It is a no-op if the
+// Operation has already finished.
+func (o *Operation) Cancel() {
+	o.mu.Lock()
+	cancel := o.cancel
+	o.mu.Unlock()
+
+	if !o.finish(func() { o.State = OperationCancelled }) {
+		return
+	}
+	if cancel != nil {
+		cancel()
+	}
+	o.closeWatchers()
+}
+
+// finish runs mutate and marks the Operation terminal, unless it has
+// already reached a terminal state, in which case it does nothing and
+// returns false.
+func (o *Operation) finish(mutate func()) bool {
+	applied := false
+	o.update(func() {
+		if isTerminal(o.State) {
+			return
+		}
+		mutate()
+		applied = true
+	})
+	return applied
+}
+
+func isTerminal(state OperationState) bool {
+	return state == OperationSuccess || state == OperationFailure || state == OperationCancelled
+}
+
+// Watch returns a channel that receives a snapshot of the Operation every
+// time it changes, and is closed once the Operation reaches a terminal
+// state. If the Operation is already terminal, Watch returns a channel
+// that immediately delivers the final snapshot and is closed, rather than
+// registering a watcher that would never be drained.
+func (o *Operation) Watch() <-chan *Operation {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if isTerminal(o.State) {
+		ch := make(chan *Operation, 1)
+		ch <- o.snapshot()
+		close(ch)
+		return ch
+	}
+
+	ch := make(chan *Operation, 1)
+	o.watchers = append(o.watchers, ch)
+	ch <- o.snapshot()
+	return ch
+}
+
+func (o *Operation) update(mutate func()) {
+	o.mu.Lock()
+	mutate()
+	o.UpdatedAt = time.Now()
+	snapshot := o.snapshot()
+	watchers := append([]chan *Operation(nil), o.watchers...)
+	o.mu.Unlock()
+
+	if o.manager != nil {
+		o.manager.persist(snapshot)
+	}
+	for _, ch := range watchers {
+		// Drain any unconsumed snapshot before sending so the channel
+		// always ends up holding the latest one instead of silently
+		// dropping this update -- critical for the terminal update, whose
+		// snapshot closeWatchers must be able to guarantee was delivered.
+		select {
+		case <-ch:
+		default:
+		}
+		ch <- snapshot
+	}
+}
+
+func (o *Operation) closeWatchers() {
+	o.mu.Lock()
+	watchers := o.watchers
+	o.watchers = nil
+	o.mu.Unlock()
+
+	for _, ch := range watchers {
+		close(ch)
+	}
+}
+
+// Snapshot returns a copy of the Operation safe to hand to a caller (e.g.
+// for JSON encoding, or to return from a task handler) without racing the
+// background goroutine that mutates the original via update(). Every task
+// handler that hands an Operation back to a caller -- whether it just
+// created it or is reporting on an existing one -- should return
+// op.Snapshot(), never the Operation itself.
+func (o *Operation) Snapshot() *Operation {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.snapshot()
+}
+
+// snapshot must be called with o.mu held.
+func (o *Operation) snapshot() *Operation {
+	metadata := make(map[string]interface{}, len(o.Metadata))
+	for k, v := range o.Metadata {
+		metadata[k] = v
+	}
+	return &Operation{
+		ID:        o.ID,
+		State:     o.State,
+		Metadata:  metadata,
+		Result:    o.Result,
+		Err:       o.Err,
+		CreatedAt: o.CreatedAt,
+		UpdatedAt: o.UpdatedAt,
+	}
+}
+
+// OperationIDArgs are arguments for the operation-wait, operation-get, and
+// operation-cancel tasks.
+type OperationIDArgs struct {
+	ID string `json:"id"`
+}
+
+// RegisterOperationTasks registers the operation-wait, operation-get, and
+// operation-cancel tasks with the server, backed by manager.
+func RegisterOperationTasks(server *provider.Server, manager *OperationManager) {
+	server.RegisterTask("operation-get", func(req *Request) (interface{}, *url.URL, error) {
+		var args OperationIDArgs
+		if err := req.UnmarshalArgs(&args); err != nil {
+			return nil, nil, err
+		}
+		op := manager.Get(args.ID)
+		if op == nil {
+			return nil, nil, errors.Newv("operation not found", map[string]interface{}{"id": args.ID})
+		}
+		return op.Snapshot(), nil, nil
+	})
+
+	server.RegisterTask("operation-cancel", func(req *Request) (interface{}, *url.URL, error) {
+		var args OperationIDArgs
+		if err := req.UnmarshalArgs(&args); err != nil {
+			return nil, nil, err
+		}
+		op := manager.Get(args.ID)
+		if op == nil {
+			return nil, nil, errors.Newv("operation not found", map[string]interface{}{"id": args.ID})
+		}
+		op.Cancel()
+		return op.Snapshot(), nil, nil
+	})
+
+	server.RegisterTask("operation-wait", func(req *Request) (interface{}, *url.URL, error) {
+		var args OperationIDArgs
+		if err := req.UnmarshalArgs(&args); err != nil {
+			return nil, nil, err
+		}
+		op := manager.Get(args.ID)
+		if op == nil {
+			return nil, nil, errors.Newv("operation not found", map[string]interface{}{"id": args.ID})
+		}
+		var final *Operation
+		for snapshot := range op.Watch() {
+			final = snapshot
+		}
+		return final, nil, nil
+	})
+}
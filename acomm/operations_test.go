@@ -0,0 +1,223 @@
+package acomm
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeStore is a minimal in-memory OperationStore for exercising
+// NewOperationManager's persistence hooks without a real backing store.
+type fakeStore struct {
+	mu      sync.Mutex
+	saved   []*Operation
+	deleted []string
+	loaded  []*Operation
+	err     error
+}
+
+func (s *fakeStore) SaveOperation(op *Operation) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.saved = append(s.saved, op.Snapshot())
+	return nil
+}
+
+func (s *fakeStore) LoadOperations() ([]*Operation, error) {
+	return s.loaded, s.err
+}
+
+func (s *fakeStore) DeleteOperation(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.deleted = append(s.deleted, id)
+	return nil
+}
+
+func TestOperationManagerNew(t *testing.T) {
+	manager, err := NewOperationManager(nil)
+	assert.NoError(t, err)
+
+	op := manager.New(nil)
+	assert.Equal(t, OperationPending, op.State)
+	assert.Equal(t, op, manager.Get(op.ID))
+	assert.Nil(t, manager.Get("does-not-exist"))
+}
+
+func TestOperationManagerLoadsExisting(t *testing.T) {
+	existing := &Operation{ID: "existing", State: OperationSuccess}
+	store := &fakeStore{loaded: []*Operation{existing}}
+
+	manager, err := NewOperationManager(store)
+	assert.NoError(t, err)
+	assert.Equal(t, existing, manager.Get("existing"))
+}
+
+func TestOperationManagerDeletesFromStoreOnTerminal(t *testing.T) {
+	store := &fakeStore{}
+	manager, err := NewOperationManager(store)
+	assert.NoError(t, err)
+
+	op := manager.New(nil)
+	op.Running()
+	op.Succeed("done")
+
+	assert.Equal(t, []string{op.ID}, store.deleted)
+}
+
+func TestOperationManagerForget(t *testing.T) {
+	manager, err := NewOperationManager(nil)
+	assert.NoError(t, err)
+
+	op := manager.New(nil)
+	manager.Forget(op.ID)
+	assert.Nil(t, manager.Get(op.ID))
+}
+
+func TestOperationStateTransitions(t *testing.T) {
+	manager, err := NewOperationManager(nil)
+	assert.NoError(t, err)
+
+	t.Run("running", func(t *testing.T) {
+		op := manager.New(nil)
+		op.Running()
+		assert.Equal(t, OperationRunning, op.State)
+	})
+
+	t.Run("progress merges metadata without changing state", func(t *testing.T) {
+		op := manager.New(nil)
+		op.Running()
+		op.Progress(map[string]interface{}{"a": 1})
+		op.Progress(map[string]interface{}{"b": 2})
+		assert.Equal(t, OperationRunning, op.State)
+		assert.Equal(t, map[string]interface{}{"a": 1, "b": 2}, op.Metadata)
+	})
+
+	t.Run("succeed", func(t *testing.T) {
+		op := manager.New(nil)
+		op.Succeed("done")
+		assert.Equal(t, OperationSuccess, op.State)
+		assert.Equal(t, "done", op.Result)
+	})
+
+	t.Run("fail", func(t *testing.T) {
+		op := manager.New(nil)
+		op.Fail(assert.AnError)
+		assert.Equal(t, OperationFailure, op.State)
+		assert.Equal(t, assert.AnError.Error(), op.Err)
+	})
+
+	t.Run("cancel invokes its cancel func", func(t *testing.T) {
+		cancelled := false
+		op := manager.New(func() { cancelled = true })
+		op.Cancel()
+		assert.Equal(t, OperationCancelled, op.State)
+		assert.True(t, cancelled)
+	})
+
+	t.Run("terminal states are sticky", func(t *testing.T) {
+		op := manager.New(nil)
+		op.Succeed("first")
+		op.Fail(assert.AnError)
+		op.Cancel()
+		assert.Equal(t, OperationSuccess, op.State)
+		assert.Equal(t, "first", op.Result)
+	})
+}
+
+func TestOperationSnapshotIsACopy(t *testing.T) {
+	manager, err := NewOperationManager(nil)
+	assert.NoError(t, err)
+
+	op := manager.New(nil)
+	op.Progress(map[string]interface{}{"k": "v"})
+
+	snapshot := op.Snapshot()
+	snapshot.Metadata["k"] = "mutated"
+	snapshot.State = OperationCancelled
+
+	assert.Equal(t, "v", op.Metadata["k"])
+	assert.Equal(t, OperationPending, op.State)
+}
+
+func TestOperationWatchAlreadyTerminal(t *testing.T) {
+	manager, err := NewOperationManager(nil)
+	assert.NoError(t, err)
+
+	op := manager.New(nil)
+	op.Succeed("done")
+
+	var snapshots []*Operation
+	for snapshot := range op.Watch() {
+		snapshots = append(snapshots, snapshot)
+	}
+	if assert.Len(t, snapshots, 1) {
+		assert.Equal(t, OperationSuccess, snapshots[0].State)
+	}
+}
+
+// TestOperationWatchDeliversTerminalSnapshot guards against the update()
+// regression where a full, undrained watcher channel could silently drop
+// the terminal snapshot: it fires several updates before the watcher ever
+// reads, then asserts the last snapshot received is still the terminal one.
+func TestOperationWatchDeliversTerminalSnapshot(t *testing.T) {
+	manager, err := NewOperationManager(nil)
+	assert.NoError(t, err)
+
+	op := manager.New(nil)
+	watch := op.Watch()
+
+	op.Running()
+	op.Progress(map[string]interface{}{"step": 1})
+	op.Progress(map[string]interface{}{"step": 2})
+	op.Succeed("done")
+
+	var final *Operation
+	for snapshot := range watch {
+		final = snapshot
+	}
+
+	if assert.NotNil(t, final) {
+		assert.Equal(t, OperationSuccess, final.State)
+		assert.Equal(t, "done", final.Result)
+	}
+}
+
+func TestOperationManagerPersists(t *testing.T) {
+	store := &fakeStore{}
+	manager, err := NewOperationManager(store)
+	assert.NoError(t, err)
+
+	op := manager.New(nil)
+	op.Running()
+	op.Succeed("done")
+
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	// Pending and running are saved; the terminal update deletes instead.
+	if assert.True(t, len(store.saved) == 2) {
+		last := store.saved[len(store.saved)-1]
+		assert.Equal(t, OperationRunning, last.State)
+	}
+}
+
+func TestOperationIsTerminal(t *testing.T) {
+	assert.False(t, isTerminal(OperationPending))
+	assert.False(t, isTerminal(OperationRunning))
+	assert.True(t, isTerminal(OperationSuccess))
+	assert.True(t, isTerminal(OperationFailure))
+	assert.True(t, isTerminal(OperationCancelled))
+}
+
+func TestOperationUpdatedAtAdvances(t *testing.T) {
+	manager, err := NewOperationManager(nil)
+	assert.NoError(t, err)
+
+	op := manager.New(nil)
+	before := op.UpdatedAt
+	time.Sleep(time.Millisecond)
+	op.Running()
+	assert.True(t, op.UpdatedAt.After(before))
+}
@@ -1,18 +1,40 @@
 package main
 
 import (
+	"encoding/json"
 	"fmt"
 	"net"
 	"strconv"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/cerana/cerana/acomm"
 	"github.com/cerana/cerana/providers/clusterconf"
+	"github.com/cerana/cerana/providers/health"
 	"github.com/cerana/cerana/providers/systemd"
 	"github.com/pborman/uuid"
 	"github.com/shirou/gopsutil/host"
 )
 
+// healthCheckConcurrency bounds how many individual health checks are
+// dispatched at once, across every bundle in a single heartbeat cycle.
+const healthCheckConcurrency = 16
+
+// healthCheckSem is the global budget backing healthCheckConcurrency. Every
+// bundle's checks share it, so a bundle with many services/checks can't
+// blow past the cap just because it runs in its own goroutine.
+var healthCheckSem = make(chan struct{}, healthCheckConcurrency)
+
+// defaultHealthCheckTimeout is used for a HealthCheck whose args don't
+// specify their own "timeout".
+const defaultHealthCheckTimeout = 10 * time.Second
+
+// defaultConsecutiveFailures is the number of consecutive failed health
+// check rounds at which a bundle is reported unhealthy. This keeps a
+// single flap from dropping a bundle from heartbeats.
+const defaultConsecutiveFailures = 3
+
 func (s *statsPusher) bundleHeartbeats() error {
 	serial, err := s.getSerial()
 	if err != nil {
@@ -34,38 +56,42 @@ func (s *statsPusher) bundleHeartbeats() error {
 }
 
 func (s *statsPusher) getBundles() ([]*clusterconf.Bundle, error) {
-	requests := make(map[string]*acomm.Request)
-	localReq, err := acomm.NewRequest(acomm.RequestOptions{Task: "systemd-list"})
-	if err != nil {
-		return nil, err
+	options := map[string]acomm.RequestOptions{
+		"local": {Task: "systemd-list"},
+		"known": {
+			Task:    "list-bundles",
+			TaskURL: s.config.heartbeatURL(),
+		},
 	}
-	requests["local"] = localReq
-	knownReq, err := acomm.NewRequest(acomm.RequestOptions{
-		Task:    "list-bundles",
-		TaskURL: s.config.heartbeatURL(),
-	})
-	requests["known"] = knownReq
 
 	multiRequest := acomm.NewMultiRequest(s.tracker, s.config.requestTimeout())
-	for name, req := range requests {
-		if err := multiRequest.AddRequest(name, req); err != nil {
-			break
-		}
-		if err := acomm.Send(s.config.coordinatorURL(), req); err != nil {
-			multiRequest.RemoveRequest(req)
-			break
-		}
+	result, err := acomm.RunMultiRequest(multiRequest, s.config.coordinatorURL(), options, nil)
+	if _, partial := err.(*acomm.PartialFailure); err != nil && !partial {
+		return nil, err
 	}
 
-	responses := multiRequest.Responses()
-
+	local, ok := result.Results["local"]
+	if !ok {
+		return nil, fmt.Errorf("failed to list local units: no response")
+	}
+	if local.Error != nil {
+		return nil, fmt.Errorf("failed to list local units: %v", local.Error)
+	}
 	var localUnits systemd.ListResult
-	if err := responses["local"].UnmarshalResult(&localUnits); err != nil {
+	if err := local.Response.UnmarshalResult(&localUnits); err != nil {
 		return nil, err
 	}
 	localBundles := extractBundles(localUnits.Units)
+
+	known, ok := result.Results["known"]
+	if !ok {
+		return nil, fmt.Errorf("failed to list known bundles: no response")
+	}
+	if known.Error != nil {
+		return nil, fmt.Errorf("failed to list known bundles: %v", known.Error)
+	}
 	var knownBundles clusterconf.BundleListResult
-	if err := responses["known"].UnmarshalResult(&knownBundles); err != nil {
+	if err := known.Response.UnmarshalResult(&knownBundles); err != nil {
 		return nil, err
 	}
 
@@ -116,12 +142,19 @@ func (s *statsPusher) getSerial() (string, error) {
 	return data.Hostname, nil
 }
 
-func (s *statsPusher) sendBundleHeartbeats(bundles []uint64, serial string, ip net.IP) error {
-	errored := make([]uint64, 0, len(bundles))
+// bundleHeartbeatRetryPolicy retries a bundle's heartbeat a couple times
+// before giving up on it, so one flaky node doesn't wipe out heartbeats for
+// the whole cluster.
+var bundleHeartbeatRetryPolicy = &acomm.RetryPolicy{
+	MaxAttempts: 3,
+	Backoff:     time.Second,
+	Jitter:      500 * time.Millisecond,
+}
 
-	multiRequest := acomm.NewMultiRequest(s.tracker, s.config.requestTimeout())
+func (s *statsPusher) sendBundleHeartbeats(bundles []uint64, serial string, ip net.IP) error {
+	options := make(map[string]acomm.RequestOptions, len(bundles))
 	for _, bundle := range bundles {
-		req, err := acomm.NewRequest(acomm.RequestOptions{
+		options[strconv.FormatUint(bundle, 10)] = acomm.RequestOptions{
 			Task:    "bundle-heartbeat",
 			TaskURL: s.config.heartbeatURL(),
 			Args: clusterconf.BundleHeartbeatArgs{
@@ -129,47 +162,262 @@ func (s *statsPusher) sendBundleHeartbeats(bundles []uint64, serial string, ip n
 				Serial: serial,
 				IP:     ip,
 			},
-		})
-		if err != nil {
-			errored = append(errored, bundle)
-			continue
-		}
-		if err := multiRequest.AddRequest(strconv.FormatUint(bundle, 10), req); err != nil {
-			errored = append(errored, bundle)
-			continue
-		}
-		if err := acomm.Send(s.config.coordinatorURL(), req); err != nil {
-			multiRequest.RemoveRequest(req)
-			errored = append(errored, bundle)
-			continue
 		}
 	}
 
-	responses := multiRequest.Responses()
-	for name, resp := range responses {
-		if resp.Error != nil {
-			bundle, _ := strconv.ParseUint(name, 10, 64)
-			errored = append(errored, bundle)
-			break
-		}
+	multiRequest := acomm.NewMultiRequest(s.tracker, s.config.requestTimeout())
+	result, err := acomm.RunMultiRequest(multiRequest, s.config.coordinatorURL(), options, bundleHeartbeatRetryPolicy)
+	if _, partial := err.(*acomm.PartialFailure); err != nil && !partial {
+		return err
 	}
 
-	if len(errored) > 0 {
+	if errored := result.Failed(); len(errored) > 0 {
 		return fmt.Errorf("one or more bundle heartbeats unsuccessful: %+v", errored)
 	}
 	return nil
 }
 
-// TODO: Make this actually run health checks
-// Issue: #189
+// healthCheckRetryPolicy retries a health check once before counting it as
+// failed, so one dropped response doesn't fail a bundle outright.
+var healthCheckRetryPolicy = &acomm.RetryPolicy{
+	MaxAttempts: 2,
+	Backoff:     time.Second,
+}
+
+// checkState is the last known outcome of a single health check, keyed by
+// bundle and check name.
+type checkState struct {
+	lastRun time.Time
+	passed  bool
+}
+
+// checkIntervalTracker remembers when each health check last ran and
+// whether it passed, so bundleChecksPass can honor a check's configured
+// Envelope.Interval instead of re-dispatching it every heartbeat cycle.
+type checkIntervalTracker struct {
+	mu    sync.Mutex
+	state map[string]checkState
+}
+
+var checkIntervalState = &checkIntervalTracker{state: make(map[string]checkState)}
+
+// due reports whether a check keyed by name is due to run: a check with no
+// interval, or no recorded state yet, is always due. A check whose interval
+// hasn't elapsed since its last run is not due, and its last result should
+// be reused instead.
+func (t *checkIntervalTracker) due(name string, interval time.Duration) (lastPassed bool, isDue bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	state, ok := t.state[name]
+	if interval <= 0 || !ok || time.Since(state.lastRun) >= interval {
+		return false, true
+	}
+	return state.passed, false
+}
+
+func (t *checkIntervalTracker) record(name string, passed bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.state[name] = checkState{lastRun: time.Now(), passed: passed}
+}
+
+// checkEnvelope extracts a HealthCheck's Envelope (timeout, interval, ...)
+// from its opaque Args, so the pusher can honor per-check configuration
+// without needing to know any probe's specific argument type.
+func checkEnvelope(check clusterconf.HealthCheck) health.Envelope {
+	var envelope health.Envelope
+	raw, err := json.Marshal(check.Args)
+	if err != nil {
+		return envelope
+	}
+	_ = json.Unmarshal(raw, &envelope)
+	return envelope
+}
+
+// runHealthChecks executes each bundle's service health checks and returns
+// the IDs of the bundles considered healthy. A bundle is healthy if it has
+// no health checks, or if all of its checks currently pass; a bundle whose
+// checks fail is still reported healthy until it accumulates enough
+// consecutive failing rounds, so a single flap doesn't drop it from
+// heartbeats. That threshold defaults to defaultConsecutiveFailures; a
+// check can lower it for its bundle via its own Envelope's
+// ConsecutiveFailures, but a value above the default does not raise it.
 func (s *statsPusher) runHealthChecks(bundles []*clusterconf.Bundle) ([]uint64, error) {
-	healthy := make([]uint64, len(bundles))
-	for i, bundle := range bundles {
-		healthy[i] = bundle.ID
+	type result struct {
+		id        uint64
+		passed    bool
+		threshold int
+	}
+
+	healthy := make([]uint64, 0, len(bundles))
+	results := make(chan result, len(bundles))
+
+	// Bundles themselves run unbounded -- they're cheap goroutines that
+	// mostly wait on healthCheckSem -- which is what actually bounds the
+	// number of health checks in flight at once, at the check level rather
+	// than the bundle level.
+	var wg sync.WaitGroup
+	for _, bundle := range bundles {
+		bundle := bundle
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			passed, threshold := s.bundleChecksPass(bundle)
+			results <- result{id: bundle.ID, passed: passed, threshold: threshold}
+		}()
 	}
+
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	for r := range results {
+		if bundleHealthState.recordResult(r.id, r.threshold, r.passed) {
+			healthy = append(healthy, r.id)
+		}
+	}
+
 	return healthy, nil
 }
 
+// namedCheck pairs a bundle's HealthCheck with the name it's dispatched
+// and recorded under: "<serviceID>:<check name>".
+type namedCheck struct {
+	name  string
+	check clusterconf.HealthCheck
+}
+
+// bundleChecksPass dispatches every health check defined by the bundle's
+// services as acomm tasks, by HealthCheck.Type, and reports whether all of
+// them passed, along with the bundle's consecutive-failures threshold. A
+// check whose Envelope sets an Interval is only re-dispatched once that
+// interval has elapsed since it last ran; in between, its last recorded
+// result is reused. Due checks are dispatched in batches of at most
+// healthCheckConcurrency, each batch holding one healthCheckSem slot per
+// check, so this bundle's checks share the same global concurrency budget
+// as every other bundle's.
+func (s *statsPusher) bundleChecksPass(bundle *clusterconf.Bundle) (bool, int) {
+	var checks []namedCheck
+	for _, service := range bundle.Services {
+		for name, check := range service.HealthChecks {
+			checks = append(checks, namedCheck{name: service.ID + ":" + name, check: check})
+		}
+	}
+	if len(checks) == 0 {
+		return true, defaultConsecutiveFailures
+	}
+
+	bundleKey := strconv.FormatUint(bundle.ID, 10)
+	passed := true
+	threshold := defaultConsecutiveFailures
+
+	var due []namedCheck
+	for _, nc := range checks {
+		envelope := checkEnvelope(nc.check)
+		stateKey := bundleKey + ":" + nc.name
+
+		// The strictest check governs: if any check wants the bundle
+		// declared unhealthy sooner than the default, honor that instead
+		// of averaging it away against laxer checks.
+		if checkThreshold := envelope.ConsecutiveFailuresOrDefault(defaultConsecutiveFailures); checkThreshold < threshold {
+			threshold = checkThreshold
+		}
+
+		if lastPassed, isDue := checkIntervalState.due(stateKey, time.Duration(envelope.Interval)); !isDue {
+			passed = passed && lastPassed
+			continue
+		}
+		due = append(due, nc)
+	}
+
+	for start := 0; start < len(due); start += healthCheckConcurrency {
+		end := start + healthCheckConcurrency
+		if end > len(due) {
+			end = len(due)
+		}
+		if !s.dispatchChecks(bundleKey, due[start:end]) {
+			passed = false
+		}
+	}
+
+	return passed, threshold
+}
+
+// dispatchChecks sends one batch of at most healthCheckConcurrency checks
+// through RunMultiRequest with healthCheckRetryPolicy, the same as
+// sendBundleHeartbeats, so one flaky response doesn't fail the whole
+// bundle. It holds one healthCheckSem slot per check in the batch for the
+// duration of the call, and reports whether every check in the batch
+// passed.
+func (s *statsPusher) dispatchChecks(bundleKey string, batch []namedCheck) bool {
+	for range batch {
+		healthCheckSem <- struct{}{}
+	}
+	defer func() {
+		for range batch {
+			<-healthCheckSem
+		}
+	}()
+
+	timeout := defaultHealthCheckTimeout
+	options := make(map[string]acomm.RequestOptions, len(batch))
+	for _, nc := range batch {
+		envelope := checkEnvelope(nc.check)
+		if checkTimeout := envelope.TimeoutOrDefault(defaultHealthCheckTimeout); checkTimeout > timeout {
+			timeout = checkTimeout
+		}
+		options[nc.name] = acomm.RequestOptions{
+			Task:    nc.check.Type,
+			TaskURL: s.config.heartbeatURL(),
+			Args:    nc.check.Args,
+		}
+	}
+	if configured := s.config.requestTimeout(); configured > timeout {
+		timeout = configured
+	}
+
+	multiRequest := acomm.NewMultiRequest(s.tracker, timeout)
+	result, _ := acomm.RunMultiRequest(multiRequest, s.config.coordinatorURL(), options, healthCheckRetryPolicy)
+
+	passed := true
+	for _, nc := range batch {
+		checkPassed := false
+		if r, ok := result.Results[nc.name]; ok && r.Error == nil {
+			checkPassed = true
+		}
+		checkIntervalState.record(bundleKey+":"+nc.name, checkPassed)
+		passed = passed && checkPassed
+	}
+	return passed
+}
+
+// bundleHealthTracker records consecutive health check failures per bundle
+// across heartbeat cycles.
+type bundleHealthTracker struct {
+	mu                  sync.Mutex
+	consecutiveFailures map[uint64]int
+}
+
+var bundleHealthState = &bundleHealthTracker{consecutiveFailures: make(map[uint64]int)}
+
+// recordResult records the outcome of a health check round for a bundle and
+// reports whether the bundle should still be considered healthy: true if
+// the round passed, or if it failed but hasn't yet reached threshold
+// consecutive failures.
+func (t *bundleHealthTracker) recordResult(bundleID uint64, threshold int, passed bool) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if passed {
+		delete(t.consecutiveFailures, bundleID)
+		return true
+	}
+
+	t.consecutiveFailures[bundleID]++
+	return t.consecutiveFailures[bundleID] < threshold
+}
+
 func extractBundles(units []systemd.UnitStatus) []uint64 {
 	dedupe := make(map[uint64]bool)
 	for _, unit := range units {
@@ -185,4 +433,4 @@ func extractBundles(units []systemd.UnitStatus) []uint64 {
 		ids = append(ids, id)
 	}
 	return ids
-}
\ No newline at end of file
+}
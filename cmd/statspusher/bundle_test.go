@@ -0,0 +1,79 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/cerana/cerana/providers/clusterconf"
+	"github.com/cerana/cerana/providers/health"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckIntervalTrackerDue(t *testing.T) {
+	tr := &checkIntervalTracker{state: make(map[string]checkState)}
+
+	// Never recorded: always due, regardless of interval.
+	lastPassed, isDue := tr.due("check", time.Minute)
+	assert.True(t, isDue)
+	assert.False(t, lastPassed)
+
+	tr.record("check", true)
+
+	// Interval hasn't elapsed: not due, last result reused.
+	lastPassed, isDue = tr.due("check", time.Hour)
+	assert.False(t, isDue)
+	assert.True(t, lastPassed)
+
+	// No interval set: always due even with recorded state.
+	lastPassed, isDue = tr.due("check", 0)
+	assert.True(t, isDue)
+	assert.False(t, lastPassed)
+}
+
+func TestCheckIntervalTrackerDueAfterIntervalElapses(t *testing.T) {
+	tr := &checkIntervalTracker{state: make(map[string]checkState)}
+	tr.state["check"] = checkState{lastRun: time.Now().Add(-time.Hour), passed: false}
+
+	lastPassed, isDue := tr.due("check", time.Minute)
+	assert.True(t, isDue)
+	assert.False(t, lastPassed)
+}
+
+func TestBundleHealthTrackerRecordResult(t *testing.T) {
+	tr := &bundleHealthTracker{consecutiveFailures: make(map[uint64]int)}
+
+	// Passes are always healthy and reset the failure count.
+	assert.True(t, tr.recordResult(1, 3, true))
+
+	// Failures stay healthy until the threshold is reached.
+	assert.True(t, tr.recordResult(1, 3, false))
+	assert.True(t, tr.recordResult(1, 3, false))
+	assert.False(t, tr.recordResult(1, 3, false))
+
+	// A subsequent pass resets the streak.
+	assert.True(t, tr.recordResult(1, 3, true))
+	assert.True(t, tr.recordResult(1, 3, false))
+}
+
+func TestCheckEnvelope(t *testing.T) {
+	check := clusterconf.HealthCheck{
+		Type: "health-tcp",
+		Args: map[string]interface{}{
+			"timeout":             "5s",
+			"retries":             2,
+			"interval":            "30s",
+			"consecutiveFailures": 5,
+		},
+	}
+
+	envelope := checkEnvelope(check)
+	assert.Equal(t, health.Duration(5*time.Second), envelope.Timeout)
+	assert.Equal(t, 2, envelope.Retries)
+	assert.Equal(t, health.Duration(30*time.Second), envelope.Interval)
+	assert.Equal(t, 5, envelope.ConsecutiveFailures)
+}
+
+func TestCheckEnvelopeUnmarshalableArgsReturnsZeroValue(t *testing.T) {
+	check := clusterconf.HealthCheck{Type: "health-tcp", Args: make(chan int)}
+	assert.Equal(t, health.Envelope{}, checkEnvelope(check))
+}
@@ -0,0 +1,126 @@
+package clusterconf
+
+import (
+	"sync"
+	"time"
+
+	"github.com/cerana/cerana/pkg/errors"
+)
+
+// kvWatchPollInterval is how often kvWatch re-lists its prefix looking for
+// changes.
+const kvWatchPollInterval = time.Second
+
+// kvValue is a single key's raw data and ModIndex, as returned by kvList.
+type kvValue struct {
+	Data  []byte
+	Index uint64
+}
+
+// kvList lists every key under prefix along with its current value and
+// ModIndex. It's the listing counterpart to kvGet/kvUpdate/kvDelete that
+// kvWatch needs to notice keys appearing and disappearing under a prefix.
+func (c *ClusterConf) kvList(prefix string) (map[string]kvValue, error) {
+	pairs, err := c.kv.List(prefix)
+	if err != nil {
+		return nil, errors.Wrapv(err, map[string]interface{}{"prefix": prefix})
+	}
+
+	values := make(map[string]kvValue, len(pairs))
+	for _, pair := range pairs {
+		values[pair.Key] = kvValue{Data: pair.Value, Index: pair.ModifyIndex}
+	}
+	return values, nil
+}
+
+// kvWatch subscribes to create/update/delete changes for keys under prefix.
+// It returns a channel of kvWatchEvents in the order they're observed and a
+// stop function to tear the subscription down; the channel is closed once
+// stop is called.
+//
+// If startIndex is non-zero, kvWatch first replays every key under prefix
+// whose ModIndex is greater than startIndex as an update event, so a caller
+// resuming a dropped subscription with the last ModIndex it saw catches up
+// on changes it missed. A key deleted while the caller was disconnected
+// can't be replayed this way -- kvList only sees what currently exists --
+// so a caller that needs to notice those should treat a resumed watch as
+// best-effort catch-up, not a guaranteed replay of every missed event.
+//
+// kvWatch polls kvList rather than using a single blocking round-trip,
+// since that's the only listing primitive this package has; the tradeoff
+// is one full list of prefix per kvWatchPollInterval instead of one
+// blocking call per change.
+func (c *ClusterConf) kvWatch(prefix string, startIndex uint64) (<-chan kvWatchEvent, func(), error) {
+	seen, err := c.kvList(prefix)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	events := make(chan kvWatchEvent)
+	done := make(chan struct{})
+	var stopOnce sync.Once
+	stop := func() { stopOnce.Do(func() { close(done) }) }
+
+	go func() {
+		defer close(events)
+
+		for key, value := range seen {
+			if startIndex > 0 && value.Index > startIndex {
+				if !kvEmit(events, done, kvWatchEvent{Type: WatchEventUpdated, Key: key, Data: value.Data, Index: value.Index}) {
+					return
+				}
+			}
+		}
+
+		ticker := time.NewTicker(kvWatchPollInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+			}
+
+			current, err := c.kvList(prefix)
+			if err != nil {
+				return
+			}
+
+			for key, value := range current {
+				prev, existed := seen[key]
+				switch {
+				case !existed:
+					if !kvEmit(events, done, kvWatchEvent{Type: WatchEventCreated, Key: key, Data: value.Data, Index: value.Index}) {
+						return
+					}
+				case prev.Index != value.Index:
+					if !kvEmit(events, done, kvWatchEvent{Type: WatchEventUpdated, Key: key, Data: value.Data, Index: value.Index, PreviousIndex: prev.Index}) {
+						return
+					}
+				}
+			}
+			for key, prev := range seen {
+				if _, ok := current[key]; !ok {
+					if !kvEmit(events, done, kvWatchEvent{Type: WatchEventDeleted, Key: key, PreviousIndex: prev.Index}) {
+						return
+					}
+				}
+			}
+			seen = current
+		}
+	}()
+
+	return events, stop, nil
+}
+
+// kvEmit sends event on events, reporting whether it was delivered; it
+// returns false, without blocking forever, if done fires first.
+func kvEmit(events chan<- kvWatchEvent, done <-chan struct{}, event kvWatchEvent) bool {
+	select {
+	case events <- event:
+		return true
+	case <-done:
+		return false
+	}
+}
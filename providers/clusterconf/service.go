@@ -29,6 +29,7 @@ type ServiceConf struct {
 	Limits       ResourceLimits         `json:"limits"`
 	Env          map[string]string      `json:"env"`
 	Cmd          []string               `json:"cmd"`
+	Labels       map[string]string      `json:"labels"`
 }
 
 // ResourceLimits is configuration for resource upper bounds.
@@ -0,0 +1,185 @@
+package clusterconf
+
+import (
+	"encoding/json"
+	"net/url"
+	"strings"
+
+	"github.com/cerana/cerana/acomm"
+	"github.com/cerana/cerana/pkg/errors"
+	"github.com/cerana/cerana/provider"
+)
+
+// WatchEventType describes the kind of change a watch event represents.
+type WatchEventType string
+
+// Possible WatchEventTypes.
+const (
+	WatchEventCreated WatchEventType = "created"
+	WatchEventUpdated WatchEventType = "updated"
+	WatchEventDeleted WatchEventType = "deleted"
+)
+
+// kvWatchEvent is a single change reported by the kv layer's watch
+// primitive for a key under a watched prefix.
+type kvWatchEvent struct {
+	Type          WatchEventType
+	Key           string
+	Data          []byte
+	Index         uint64
+	PreviousIndex uint64
+}
+
+// watchOps tracks the operations backing WatchService/WatchBundle
+// subscriptions. It's package-level, rather than a ClusterConf field,
+// since a subscription just streams kv events and doesn't need per-watch
+// provider state.
+var watchOps, _ = acomm.NewOperationManager(nil)
+
+// RegisterWatchTasks registers the watch-service and watch-bundle tasks,
+// plus the operation-wait/-get/-cancel tasks that back them, with the
+// server. Call it alongside the rest of ClusterConf's task registration.
+//
+// Note: unlike the zfs and health providers, ClusterConf does not get a
+// functional-options constructor or an overridable task map here -- its
+// constructor and existing task set live outside this package slice, so
+// converting it would mean guessing at a struct this code can't see.
+// RegisterWatchTasks only adds the watch subsystem using the same
+// RegisterTask idiom as the rest of ClusterConf's tasks; the broader
+// construction-idiom convergence requested for clusterconf is not done by
+// this function and needs a follow-up that touches ClusterConf's own
+// constructor.
+func (c *ClusterConf) RegisterWatchTasks(server *provider.Server) {
+	server.RegisterTask("watch-service", c.WatchService)
+	server.RegisterTask("watch-bundle", c.WatchBundle)
+	server.RegisterTask("watch-poll", watchPoll)
+	acomm.RegisterOperationTasks(server, watchOps)
+}
+
+// watchPoll handles the watch-poll task: it returns every ServiceEvent or
+// BundleEvent queued for a watch-service/watch-bundle Operation since
+// args.Index, in order. Unlike operation-get/-wait, which only ever expose
+// the latest acomm.Operation snapshot, watch-poll is how a caller actually
+// drains the subscription's event stream without dropping events that
+// arrived between two polls.
+func watchPoll(req *acomm.Request) (interface{}, *url.URL, error) {
+	var args WatchPollArgs
+	if err := req.UnmarshalArgs(&args); err != nil {
+		return nil, nil, err
+	}
+	if watchOps.Get(args.ID) == nil {
+		return nil, nil, errors.Newv("operation not found", map[string]interface{}{"id": args.ID})
+	}
+
+	queue := getQueue(args.ID)
+	if queue == nil {
+		return &WatchPollResult{NextIndex: args.Index}, nil, nil
+	}
+	events, next := queue.since(args.Index)
+	return &WatchPollResult{Events: events, NextIndex: next}, nil, nil
+}
+
+// WatchArgs are the common arguments for WatchService and WatchBundle: the
+// caller can resume from a ModIndex it already has, and filter which
+// changes it hears about.
+type WatchArgs struct {
+	// StartIndex, if non-zero, resumes the subscription after this
+	// ModIndex instead of starting from the current state.
+	StartIndex uint64 `json:"startIndex"`
+	// IDPrefix, if set, limits events to IDs with this prefix.
+	IDPrefix string `json:"idPrefix"`
+	// Label, if set, limits events to configs carrying this label.
+	Label string `json:"label"`
+	// All, if true, ignores IDPrefix/Label and watches everything.
+	All bool `json:"all"`
+}
+
+// idFromKey recovers the resource id from a kv key under prefix (e.g.
+// "services/<id>/config"). A delete event carries no Data to unmarshal an
+// id out of, so callers filtering delete events on id must derive it from
+// the key instead.
+func idFromKey(key, prefix string) string {
+	rel := strings.TrimPrefix(key, prefix+"/")
+	if idx := strings.Index(rel, "/"); idx >= 0 {
+		rel = rel[:idx]
+	}
+	return rel
+}
+
+func (a WatchArgs) matches(id string, labels map[string]string) bool {
+	if a.All {
+		return true
+	}
+	if a.IDPrefix != "" && !strings.HasPrefix(id, a.IDPrefix) {
+		return false
+	}
+	if a.Label != "" {
+		if _, ok := labels[a.Label]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// ServiceEvent is emitted by WatchService as services matching its filter
+// change.
+type ServiceEvent struct {
+	Type             WatchEventType `json:"type"`
+	Service          *ServiceConf   `json:"service"`
+	PreviousModIndex uint64         `json:"previousModIndex"`
+	ModIndex         uint64         `json:"modIndex"`
+}
+
+// WatchService subscribes to create/update/delete events for services
+// matching args, starting from args.StartIndex if given. It returns an
+// acomm.Operation for liveness and cancellation; the events themselves are
+// delivered through watch-poll (see WatchPollArgs), keyed by the returned
+// Operation's ID, so a disconnected caller can resume by calling
+// WatchService again with StartIndex set to the last ModIndex it saw.
+func (c *ClusterConf) WatchService(req *acomm.Request) (interface{}, *url.URL, error) {
+	var args WatchArgs
+	if err := req.UnmarshalArgs(&args); err != nil {
+		return nil, nil, err
+	}
+
+	events, stop, err := c.kvWatch(servicesPrefix, args.StartIndex)
+	if err != nil {
+		return nil, nil, errors.Wrapv(err, map[string]interface{}{"args": args})
+	}
+
+	op := watchOps.New(stop)
+	op.Running()
+	queue := registerQueue(op.ID)
+
+	go func() {
+		for event := range events {
+			var conf ServiceConf
+			if event.Type == WatchEventDeleted {
+				conf.ID = idFromKey(event.Key, servicesPrefix)
+			} else if err := json.Unmarshal(event.Data, &conf); err != nil {
+				op.Fail(errors.Wrapv(err, map[string]interface{}{"key": event.Key}))
+				forgetQueue(op.ID)
+				watchOps.Forget(op.ID)
+				return
+			}
+			if !args.matches(conf.ID, conf.Labels) {
+				continue
+			}
+
+			queue.push(&ServiceEvent{
+				Type:             event.Type,
+				Service:          &conf,
+				PreviousModIndex: event.PreviousIndex,
+				ModIndex:         event.Index,
+			})
+		}
+		// events closed without an error (kv watch torn down, coordinator
+		// reconnect, etc.) -- reach a terminal state so operation-wait
+		// returns instead of blocking forever.
+		op.Succeed(nil)
+		forgetQueue(op.ID)
+		watchOps.Forget(op.ID)
+	}()
+
+	return op.Snapshot(), nil, nil
+}
@@ -0,0 +1,75 @@
+package clusterconf
+
+import (
+	"encoding/json"
+	"net/url"
+	"strconv"
+
+	"github.com/cerana/cerana/acomm"
+	"github.com/cerana/cerana/pkg/errors"
+)
+
+func bundleID(bundle Bundle) string {
+	return strconv.FormatUint(bundle.ID, 10)
+}
+
+// BundleEvent is emitted by WatchBundle as bundles matching its filter
+// change.
+type BundleEvent struct {
+	Type             WatchEventType `json:"type"`
+	Bundle           *Bundle        `json:"bundle"`
+	PreviousModIndex uint64         `json:"previousModIndex"`
+	ModIndex         uint64         `json:"modIndex"`
+}
+
+// WatchBundle subscribes to create/update/delete events for bundles
+// matching args, the same way WatchService does for services: events are
+// delivered through watch-poll, keyed by the returned Operation's ID.
+func (c *ClusterConf) WatchBundle(req *acomm.Request) (interface{}, *url.URL, error) {
+	var args WatchArgs
+	if err := req.UnmarshalArgs(&args); err != nil {
+		return nil, nil, err
+	}
+
+	events, stop, err := c.kvWatch(bundlesPrefix, args.StartIndex)
+	if err != nil {
+		return nil, nil, errors.Wrapv(err, map[string]interface{}{"args": args})
+	}
+
+	op := watchOps.New(stop)
+	op.Running()
+	queue := registerQueue(op.ID)
+
+	go func() {
+		for event := range events {
+			var bundle Bundle
+			if event.Type == WatchEventDeleted {
+				if id, err := strconv.ParseUint(idFromKey(event.Key, bundlesPrefix), 10, 64); err == nil {
+					bundle.ID = id
+				}
+			} else if err := json.Unmarshal(event.Data, &bundle); err != nil {
+				op.Fail(errors.Wrapv(err, map[string]interface{}{"key": event.Key}))
+				forgetQueue(op.ID)
+				watchOps.Forget(op.ID)
+				return
+			}
+			if !args.matches(bundleID(bundle), nil) {
+				continue
+			}
+
+			queue.push(&BundleEvent{
+				Type:             event.Type,
+				Bundle:           &bundle,
+				PreviousModIndex: event.PreviousIndex,
+				ModIndex:         event.Index,
+			})
+		}
+		// events closed without an error -- reach a terminal state so
+		// operation-wait returns instead of blocking forever.
+		op.Succeed(nil)
+		forgetQueue(op.ID)
+		watchOps.Forget(op.ID)
+	}()
+
+	return op.Snapshot(), nil, nil
+}
@@ -0,0 +1,100 @@
+package clusterconf
+
+import "sync"
+
+// eventQueue buffers every event for a single watch subscription in order,
+// so a caller that only polls occasionally still sees every change instead
+// of just the latest one -- unlike acomm.Operation's Progress/Watch, which
+// coalesce to a single slot and are built for progress/terminal-result
+// reporting, not a burst of discrete events.
+type eventQueue struct {
+	mu     sync.Mutex
+	base   int // index of events[0]; events before this have been delivered and trimmed
+	events []interface{}
+}
+
+func newEventQueue() *eventQueue {
+	return &eventQueue{}
+}
+
+// push appends event to the queue.
+func (q *eventQueue) push(event interface{}) {
+	q.mu.Lock()
+	q.events = append(q.events, event)
+	q.mu.Unlock()
+}
+
+// since returns every event queued at or after index, along with the index
+// to pass on the next call so none are missed or redelivered. It also
+// trims every event before index, since a caller that's polled up to index
+// has now seen them and the queue would otherwise buffer every event ever
+// pushed for the life of the subscription.
+func (q *eventQueue) since(index int) ([]interface{}, int) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	rel := index - q.base
+	if rel < 0 {
+		rel = 0
+	}
+	if rel >= len(q.events) {
+		q.base += len(q.events)
+		q.events = nil
+		return nil, q.base
+	}
+
+	events := append([]interface{}(nil), q.events[rel:]...)
+	q.events = q.events[rel:]
+	q.base += rel
+	return events, q.base + len(q.events)
+}
+
+// watchQueues tracks the eventQueue backing each watch Operation, keyed by
+// Operation ID. It's package-level for the same reason watchOps is: a
+// subscription doesn't need per-provider state.
+var watchQueues = struct {
+	mu   sync.Mutex
+	byID map[string]*eventQueue
+}{byID: make(map[string]*eventQueue)}
+
+func registerQueue(id string) *eventQueue {
+	q := newEventQueue()
+	watchQueues.mu.Lock()
+	watchQueues.byID[id] = q
+	watchQueues.mu.Unlock()
+	return q
+}
+
+func getQueue(id string) *eventQueue {
+	watchQueues.mu.Lock()
+	defer watchQueues.mu.Unlock()
+	return watchQueues.byID[id]
+}
+
+// forgetQueue discards the eventQueue for id. Call it once the watch
+// Operation it backs has reached a terminal state, so a finished or
+// cancelled subscription doesn't hold its buffered events in memory for
+// the rest of the coordinator's lifetime.
+func forgetQueue(id string) {
+	watchQueues.mu.Lock()
+	delete(watchQueues.byID, id)
+	watchQueues.mu.Unlock()
+}
+
+// WatchPollArgs are arguments for the watch-poll task.
+type WatchPollArgs struct {
+	// ID is the watch Operation's ID, as returned by watch-service or
+	// watch-bundle.
+	ID string `json:"id"`
+	// Index resumes from the NextIndex of a previous watch-poll call; zero
+	// starts from the beginning of the subscription's buffered events.
+	Index int `json:"index"`
+}
+
+// WatchPollResult is the response from watch-poll: Events holds every
+// ServiceEvent or BundleEvent queued since Index, in order, and NextIndex
+// is the Index to pass on the next call.
+type WatchPollResult struct {
+	Events    []interface{} `json:"events"`
+	NextIndex int           `json:"nextIndex"`
+}
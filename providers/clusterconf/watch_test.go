@@ -0,0 +1,92 @@
+package clusterconf
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIdFromKey(t *testing.T) {
+	tests := []struct {
+		name   string
+		key    string
+		prefix string
+		want   string
+	}{
+		{"top-level config key", "services/abc-123/config", "services", "abc-123"},
+		{"nested key", "bundles/42/services/abc-123", "bundles", "42"},
+		{"no trailing segments", "services/abc-123", "services", "abc-123"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, idFromKey(tt.key, tt.prefix))
+		})
+	}
+}
+
+func TestWatchArgsMatches(t *testing.T) {
+	tests := []struct {
+		name   string
+		args   WatchArgs
+		id     string
+		labels map[string]string
+		want   bool
+	}{
+		{"all bypasses everything", WatchArgs{All: true}, "anything", nil, true},
+		{"no filters matches everything", WatchArgs{}, "anything", nil, true},
+		{"id prefix matches", WatchArgs{IDPrefix: "svc-"}, "svc-123", nil, true},
+		{"id prefix mismatches", WatchArgs{IDPrefix: "svc-"}, "other-123", nil, false},
+		{"label present matches", WatchArgs{Label: "prod"}, "id", map[string]string{"prod": ""}, true},
+		{"label missing mismatches", WatchArgs{Label: "prod"}, "id", map[string]string{"dev": ""}, false},
+		{"label missing map mismatches", WatchArgs{Label: "prod"}, "id", nil, false},
+		{"id prefix and label both must match", WatchArgs{IDPrefix: "svc-", Label: "prod"}, "svc-123", map[string]string{"prod": ""}, true},
+		{"id prefix matches but label doesn't", WatchArgs{IDPrefix: "svc-", Label: "prod"}, "svc-123", map[string]string{"dev": ""}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, tt.args.matches(tt.id, tt.labels))
+		})
+	}
+}
+
+func TestEventQueueSinceDeliversEveryEvent(t *testing.T) {
+	q := newEventQueue()
+	q.push("a")
+	q.push("b")
+
+	events, next := q.since(0)
+	assert.Equal(t, []interface{}{"a", "b"}, events)
+	assert.Equal(t, 2, next)
+
+	q.push("c")
+	events, next = q.since(next)
+	assert.Equal(t, []interface{}{"c"}, events)
+	assert.Equal(t, 3, next)
+
+	events, next = q.since(next)
+	assert.Empty(t, events)
+	assert.Equal(t, 3, next)
+}
+
+func TestEventQueueSinceTrimsDeliveredEvents(t *testing.T) {
+	q := newEventQueue()
+	q.push("a")
+	q.push("b")
+
+	_, next := q.since(2)
+	assert.Equal(t, 2, next)
+	assert.Empty(t, q.events, "events delivered via since should be trimmed, not retained forever")
+
+	q.push("c")
+	events, next := q.since(next)
+	assert.Equal(t, []interface{}{"c"}, events)
+	assert.Equal(t, 3, next)
+}
+
+func TestForgetQueueRemovesEntry(t *testing.T) {
+	registerQueue("op-1")
+	assert.NotNil(t, getQueue("op-1"))
+
+	forgetQueue("op-1")
+	assert.Nil(t, getQueue("op-1"))
+}
@@ -0,0 +1,70 @@
+package health
+
+import (
+	"context"
+	"net"
+	"net/url"
+	"sort"
+
+	"github.com/cerana/cerana/acomm"
+	"github.com/cerana/cerana/pkg/errors"
+)
+
+func init() {
+	RegisterProbe("health-dns", (*Health).DNS)
+}
+
+// DNSArgs are arguments for DNS health checks.
+type DNSArgs struct {
+	Envelope
+
+	Host        string   `json:"host"`
+	ExpectedIPs []string `json:"expectedIPs"`
+}
+
+// DNS succeeds if Host resolves within the configured timeout. If
+// ExpectedIPs is non-empty, the resolved addresses must match it exactly.
+func (h *Health) DNS(req *acomm.Request) (interface{}, *url.URL, error) {
+	var args DNSArgs
+	if err := req.UnmarshalArgs(&args); err != nil {
+		return nil, nil, err
+	}
+
+	if args.Host == "" {
+		return nil, nil, errors.Newv("missing arg: host", map[string]interface{}{"args": args, "missing": "host"})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), args.TimeoutOrDefault(defaultProbeTimeout))
+	defer cancel()
+
+	resolved, err := net.DefaultResolver.LookupHost(ctx, args.Host)
+	if err != nil {
+		return nil, nil, errors.Wrapv(err, map[string]interface{}{"args": args})
+	}
+
+	if len(args.ExpectedIPs) == 0 {
+		return nil, nil, nil
+	}
+
+	got := append([]string(nil), resolved...)
+	want := append([]string(nil), args.ExpectedIPs...)
+	sort.Strings(got)
+	sort.Strings(want)
+	if !equalStrings(got, want) {
+		return nil, nil, errors.Newv("resolved IPs did not match expectedIPs", map[string]interface{}{"resolved": got, "expectedIPs": want})
+	}
+
+	return nil, nil, nil
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,128 @@
+package health
+
+import (
+	"encoding/json"
+	"net/url"
+	"time"
+
+	"github.com/cerana/cerana/acomm"
+	"github.com/cerana/cerana/pkg/errors"
+)
+
+// defaultProbeTimeout is used by any probe whose args don't set an
+// Envelope.Timeout.
+const defaultProbeTimeout = 10 * time.Second
+
+// Duration is a time.Duration that unmarshals from either a JSON number of
+// nanoseconds or a duration string (e.g. "5s"), so health check args can be
+// written either way.
+type Duration time.Duration
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var asString string
+	if err := json.Unmarshal(data, &asString); err == nil {
+		parsed, err := time.ParseDuration(asString)
+		if err != nil {
+			return errors.Wrapv(err, map[string]interface{}{"duration": asString})
+		}
+		*d = Duration(parsed)
+		return nil
+	}
+
+	var asNanos int64
+	if err := json.Unmarshal(data, &asNanos); err != nil {
+		return errors.Wrapv(err, map[string]interface{}{"json": string(data)})
+	}
+	*d = Duration(asNanos)
+	return nil
+}
+
+// Envelope holds options common to every probe type: a per-check timeout,
+// a retry count, the interval the caller intends to re-run the check at,
+// an expected-latency ceiling above which a passing check is still flagged
+// as degraded, and the number of consecutive failed rounds at which
+// whatever the check backs is reported unhealthy.
+type Envelope struct {
+	Timeout             Duration `json:"timeout"`
+	Retries             int      `json:"retries"`
+	Interval            Duration `json:"interval"`
+	ExpectedLatency     Duration `json:"expectedLatency"`
+	ConsecutiveFailures int      `json:"consecutiveFailures"`
+}
+
+// ConsecutiveFailuresOrDefault returns the envelope's configured
+// ConsecutiveFailures, or def if it wasn't set (zero or negative).
+func (e Envelope) ConsecutiveFailuresOrDefault(def int) int {
+	if e.ConsecutiveFailures <= 0 {
+		return def
+	}
+	return e.ConsecutiveFailures
+}
+
+// TimeoutOrDefault returns the envelope's configured timeout, or def if
+// none was set.
+func (e Envelope) TimeoutOrDefault(def time.Duration) time.Duration {
+	if e.Timeout == 0 {
+		return def
+	}
+	return time.Duration(e.Timeout)
+}
+
+// maxAttempts returns how many times withEnvelope should try fn: one plus
+// Retries, clamped so a negative Retries doesn't disable the first attempt.
+func (e Envelope) maxAttempts() int {
+	if e.Retries < 0 {
+		return 1
+	}
+	return e.Retries + 1
+}
+
+// degraded reports whether a check that took latency to complete should be
+// flagged as degraded, per the envelope's ExpectedLatency.
+func (e Envelope) degraded(latency time.Duration) bool {
+	return e.ExpectedLatency > 0 && latency > time.Duration(e.ExpectedLatency)
+}
+
+// Result is a probe's result when its Envelope configured an
+// ExpectedLatency and the check exceeded it. A plain nil result means the
+// probe passed within ExpectedLatency, or ExpectedLatency wasn't set.
+type Result struct {
+	Degraded bool `json:"degraded"`
+}
+
+// withEnvelope wraps a probe TaskFunc so every probe honors its Envelope's
+// Retries and ExpectedLatency uniformly, instead of each probe having to
+// implement them itself: fn is retried up to Retries times after a
+// failure, and if the attempt that finally succeeds took longer than
+// ExpectedLatency, the probe's result is replaced with a Result flagging
+// it as degraded.
+func withEnvelope(fn TaskFunc) TaskFunc {
+	return func(req *acomm.Request) (interface{}, *url.URL, error) {
+		var envelope Envelope
+		_ = req.UnmarshalArgs(&envelope)
+
+		var (
+			result  interface{}
+			respURL *url.URL
+			err     error
+			latency time.Duration
+		)
+		for attempt := 0; attempt < envelope.maxAttempts(); attempt++ {
+			start := time.Now()
+			result, respURL, err = fn(req)
+			latency = time.Since(start)
+			if err == nil {
+				break
+			}
+		}
+		if err != nil {
+			return result, respURL, err
+		}
+
+		if envelope.degraded(latency) {
+			return Result{Degraded: true}, respURL, nil
+		}
+		return result, respURL, nil
+	}
+}
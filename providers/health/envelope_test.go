@@ -0,0 +1,57 @@
+package health
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDurationUnmarshalJSON(t *testing.T) {
+	t.Run("duration string", func(t *testing.T) {
+		var d Duration
+		assert.NoError(t, json.Unmarshal([]byte(`"5s"`), &d))
+		assert.Equal(t, Duration(5*time.Second), d)
+	})
+
+	t.Run("nanoseconds number", func(t *testing.T) {
+		var d Duration
+		assert.NoError(t, json.Unmarshal([]byte(`1000000000`), &d))
+		assert.Equal(t, Duration(time.Second), d)
+	})
+
+	t.Run("invalid duration string", func(t *testing.T) {
+		var d Duration
+		assert.Error(t, json.Unmarshal([]byte(`"nope"`), &d))
+	})
+
+	t.Run("not a string or number", func(t *testing.T) {
+		var d Duration
+		assert.Error(t, json.Unmarshal([]byte(`{}`), &d))
+	})
+}
+
+func TestEnvelopeTimeoutOrDefault(t *testing.T) {
+	assert.Equal(t, 10*time.Second, Envelope{}.TimeoutOrDefault(10*time.Second))
+	assert.Equal(t, 5*time.Second, Envelope{Timeout: Duration(5 * time.Second)}.TimeoutOrDefault(10*time.Second))
+}
+
+func TestEnvelopeConsecutiveFailuresOrDefault(t *testing.T) {
+	assert.Equal(t, 3, Envelope{}.ConsecutiveFailuresOrDefault(3))
+	assert.Equal(t, 3, Envelope{ConsecutiveFailures: -1}.ConsecutiveFailuresOrDefault(3))
+	assert.Equal(t, 5, Envelope{ConsecutiveFailures: 5}.ConsecutiveFailuresOrDefault(3))
+}
+
+func TestEnvelopeMaxAttempts(t *testing.T) {
+	assert.Equal(t, 1, Envelope{}.maxAttempts())
+	assert.Equal(t, 1, Envelope{Retries: -1}.maxAttempts())
+	assert.Equal(t, 3, Envelope{Retries: 2}.maxAttempts())
+}
+
+func TestEnvelopeDegraded(t *testing.T) {
+	assert.False(t, Envelope{}.degraded(time.Hour), "no ExpectedLatency set")
+	e := Envelope{ExpectedLatency: Duration(time.Second)}
+	assert.False(t, e.degraded(500*time.Millisecond))
+	assert.True(t, e.degraded(2*time.Second))
+}
@@ -0,0 +1,38 @@
+package health
+
+import (
+	"net/url"
+	"os"
+
+	"github.com/cerana/cerana/acomm"
+	"github.com/cerana/cerana/pkg/errors"
+)
+
+func init() {
+	RegisterProbe("health-file-exists", (*Health).FileExists)
+}
+
+// FileExistsArgs are arguments for FileExists health checks.
+type FileExistsArgs struct {
+	Envelope
+
+	Path string `json:"path"`
+}
+
+// FileExists succeeds if Path exists on disk.
+func (h *Health) FileExists(req *acomm.Request) (interface{}, *url.URL, error) {
+	var args FileExistsArgs
+	if err := req.UnmarshalArgs(&args); err != nil {
+		return nil, nil, err
+	}
+
+	if args.Path == "" {
+		return nil, nil, errors.Newv("missing arg: path", map[string]interface{}{"args": args, "missing": "path"})
+	}
+
+	if _, err := os.Stat(args.Path); err != nil {
+		return nil, nil, errors.Wrapv(err, map[string]interface{}{"args": args})
+	}
+
+	return nil, nil, nil
+}
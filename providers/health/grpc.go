@@ -0,0 +1,55 @@
+package health
+
+import (
+	"context"
+	"net/url"
+
+	"github.com/cerana/cerana/acomm"
+	"github.com/cerana/cerana/pkg/errors"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/health/grpc_health_v1"
+)
+
+func init() {
+	RegisterProbe("health-grpc", (*Health).GRPC)
+}
+
+// GRPCArgs are arguments for GRPC health checks.
+type GRPCArgs struct {
+	Envelope
+
+	Address string `json:"address"`
+	Service string `json:"service"`
+}
+
+// GRPC succeeds if Address answers the standard grpc.health.v1.Health
+// service with a SERVING status for Service.
+func (h *Health) GRPC(req *acomm.Request) (interface{}, *url.URL, error) {
+	var args GRPCArgs
+	if err := req.UnmarshalArgs(&args); err != nil {
+		return nil, nil, err
+	}
+
+	if args.Address == "" {
+		return nil, nil, errors.Newv("missing arg: address", map[string]interface{}{"args": args, "missing": "address"})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), args.TimeoutOrDefault(defaultProbeTimeout))
+	defer cancel()
+
+	conn, err := grpc.DialContext(ctx, args.Address, grpc.WithInsecure(), grpc.WithBlock())
+	if err != nil {
+		return nil, nil, errors.Wrapv(err, map[string]interface{}{"args": args})
+	}
+	defer func() { _ = conn.Close() }()
+
+	resp, err := grpc_health_v1.NewHealthClient(conn).Check(ctx, &grpc_health_v1.HealthCheckRequest{Service: args.Service})
+	if err != nil {
+		return nil, nil, errors.Wrapv(err, map[string]interface{}{"args": args})
+	}
+	if resp.Status != grpc_health_v1.HealthCheckResponse_SERVING {
+		return nil, nil, errors.Newv("grpc service not serving", map[string]interface{}{"args": args, "status": resp.Status.String()})
+	}
+
+	return nil, nil, nil
+}
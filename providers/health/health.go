@@ -0,0 +1,138 @@
+package health
+
+import (
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/cerana/cerana/acomm"
+	"github.com/cerana/cerana/provider"
+)
+
+// TaskFunc is the signature of a single acomm task handler.
+type TaskFunc func(*acomm.Request) (interface{}, *url.URL, error)
+
+// MetricsRecorder records per-task timing for the provider's tasks.
+type MetricsRecorder interface {
+	RecordTask(task string, duration time.Duration, err error)
+}
+
+// Health is a provider of health check tasks. Individual check types (http,
+// tcp, script, etc.) register themselves with RegisterProbe from their own
+// init functions; Health only knows how to run whatever has registered,
+// unless a caller overrides its task map with WithTaskMap.
+type Health struct {
+	tasks   map[string]TaskFunc
+	metrics MetricsRecorder
+	logger  *logrus.Entry
+}
+
+// ProbeFunc executes a single health check and reports its result in the
+// same shape as any other acomm task handler.
+type ProbeFunc func(h *Health, req *acomm.Request) (interface{}, *url.URL, error)
+
+var probes = struct {
+	mu     sync.Mutex
+	byTask map[string]ProbeFunc
+}{byTask: make(map[string]ProbeFunc)}
+
+// RegisterProbe registers a probe under an acomm task name (e.g.
+// "health-tcp"). It is intended to be called from the probe's init
+// function; registering the same task name twice is a programmer error and
+// panics.
+func RegisterProbe(taskName string, probe ProbeFunc) {
+	probes.mu.Lock()
+	defer probes.mu.Unlock()
+
+	if _, exists := probes.byTask[taskName]; exists {
+		panic("health: probe already registered for task " + taskName)
+	}
+	probes.byTask[taskName] = probe
+}
+
+// Option configures a Health provider constructed with New.
+type Option func(*Health)
+
+// WithTaskMap overrides the provider's default task -> handler mapping
+// (normally every probe registered via RegisterProbe). This lets an
+// integrator plug in custom health-check types, or stub probes out for
+// tests, without forking the package.
+func WithTaskMap(tasks map[string]TaskFunc) Option {
+	return func(h *Health) { h.tasks = tasks }
+}
+
+// WithMetrics sets a recorder that's called with the duration and error of
+// every task handled by this provider.
+func WithMetrics(metrics MetricsRecorder) Option {
+	return func(h *Health) { h.metrics = metrics }
+}
+
+// WithLogger sets the provider's logger.
+func WithLogger(logger *logrus.Entry) Option {
+	return func(h *Health) { h.logger = logger }
+}
+
+// New creates a new Health provider. Without WithTaskMap, it serves every
+// probe registered via RegisterProbe.
+func New(opts ...Option) *Health {
+	h := &Health{}
+	for _, opt := range opts {
+		opt(h)
+	}
+	if h.tasks == nil {
+		h.tasks = h.defaultTasks()
+	}
+	return h
+}
+
+// defaultTasks snapshots the probes registered via RegisterProbe into a
+// task map bound to this Health instance, with each wrapped by
+// withEnvelope so a probe's Envelope.Retries and Envelope.ExpectedLatency
+// are honored without the probe implementing them itself.
+func (h *Health) defaultTasks() map[string]TaskFunc {
+	probes.mu.Lock()
+	defer probes.mu.Unlock()
+
+	tasks := make(map[string]TaskFunc, len(probes.byTask))
+	for taskName, probe := range probes.byTask {
+		probe := probe
+		tasks[taskName] = withEnvelope(func(req *acomm.Request) (interface{}, *url.URL, error) {
+			return probe(h, req)
+		})
+	}
+	return tasks
+}
+
+// Tasks returns a copy of the provider's current task -> handler mapping --
+// the default set, or whatever WithTaskMap supplied. It's the starting
+// point WithTaskMap's doc comment refers to: take New(...).Tasks(), replace
+// or remove entries, and pass the result back in via WithTaskMap to swap in
+// mock probes for a subset of tasks without losing the rest.
+func (h *Health) Tasks() map[string]TaskFunc {
+	tasks := make(map[string]TaskFunc, len(h.tasks))
+	for name, fn := range h.tasks {
+		tasks[name] = fn
+	}
+	return tasks
+}
+
+// RegisterTasks registers the provider's task map with the server.
+func (h *Health) RegisterTasks(server *provider.Server) {
+	for taskName, fn := range h.tasks {
+		server.RegisterTask(taskName, h.instrument(taskName, fn))
+	}
+}
+
+// instrument wraps fn with metrics recording, if WithMetrics was used.
+func (h *Health) instrument(name string, fn TaskFunc) TaskFunc {
+	if h.metrics == nil {
+		return fn
+	}
+	return func(req *acomm.Request) (interface{}, *url.URL, error) {
+		start := time.Now()
+		result, respURL, err := fn(req)
+		h.metrics.RecordTask(name, time.Since(start), err)
+		return result, respURL, err
+	}
+}
@@ -0,0 +1,66 @@
+package health
+
+import (
+	"io/ioutil"
+	"net/url"
+	"os"
+	"testing"
+
+	"github.com/cerana/cerana/acomm"
+	"github.com/cerana/cerana/provider"
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testConfig(t *testing.T, dir string) *provider.Config {
+	v := viper.New()
+	flagset := pflag.NewFlagSet("health-provider", pflag.PanicOnError)
+	config := provider.NewConfig(flagset, v)
+	require.NoError(t, flagset.Parse([]string{}))
+	v.Set("service_name", "health-provider-test")
+	v.Set("socket_dir", dir)
+	v.Set("coordinator_url", "unix:///tmp/foobar")
+	v.Set("log_level", "fatal")
+	require.NoError(t, config.LoadConfig())
+	require.NoError(t, config.SetupLogging())
+	return config
+}
+
+// TestWithTaskMapOverridesDefaultTasks exercises WithTaskMap with a mock
+// "health-tcp" handler, the way an integrator swaps in a mock probe to
+// avoid exercising a real network connection for tests.
+func TestWithTaskMapOverridesDefaultTasks(t *testing.T) {
+	dir, err := ioutil.TempDir("", "health-provider-test-")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	tasks := New().Tasks()
+	assert.Contains(t, tasks, "health-tcp")
+
+	var called bool
+	tasks["health-tcp"] = func(req *acomm.Request) (interface{}, *url.URL, error) {
+		called = true
+		return "mocked", nil, nil
+	}
+	delete(tasks, "health-dns")
+
+	mock := New(WithTaskMap(tasks))
+
+	server, err := provider.NewServer(testConfig(t, dir))
+	require.NoError(t, err)
+	mock.RegisterTasks(server)
+
+	registered := server.RegisteredTasks()
+	assert.Contains(t, registered, "health-tcp")
+	assert.NotContains(t, registered, "health-dns")
+
+	req, err := acomm.NewRequest(acomm.RequestOptions{Task: "health-tcp"})
+	require.NoError(t, err)
+
+	result, _, err := mock.Tasks()["health-tcp"](req)
+	require.NoError(t, err)
+	assert.Equal(t, "mocked", result)
+	assert.True(t, called)
+}
@@ -2,24 +2,46 @@ package health
 
 import (
 	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"io/ioutil"
 	"net/http"
 	"net/url"
+	"regexp"
 
 	"github.com/cerana/cerana/acomm"
 	"github.com/cerana/cerana/pkg/errors"
 	"github.com/cerana/cerana/pkg/logrusx"
 )
 
+func init() {
+	RegisterProbe("http-status", (*Health).HTTPStatus)
+}
+
 // HTTPStatusArgs are arguments for HTTPStatus health checks.
 type HTTPStatusArgs struct {
-	URL        string `json:"url"`
-	Method     string `json:"method"`
-	Body       []byte `json:"body"`
-	StatusCode int    `json:"statusCode"`
+	Envelope
+
+	URL        string            `json:"url"`
+	Method     string            `json:"method"`
+	Body       []byte            `json:"body"`
+	StatusCode int               `json:"statusCode"`
+	Headers    map[string]string `json:"headers"`
+	BodyRegex  string            `json:"bodyRegex"`
+	// DisableRedirects stops the client from following redirects. Redirects
+	// are followed by default, matching the previous http.DefaultClient
+	// behavior, so upgrading doesn't silently change existing checks.
+	DisableRedirects bool `json:"disableRedirects"`
+
+	SkipVerify bool   `json:"skipVerify"`
+	CABundle   string `json:"caBundle"`
+	ClientCert string `json:"clientCert"`
+	ClientKey  string `json:"clientKey"`
 }
 
 // HTTPStatus makes an HTTP request to the specified URL and compares the
-// response status code to an expected status code.
+// response status code to an expected status code. It can optionally also
+// check the response body against a regex.
 func (h *Health) HTTPStatus(req *acomm.Request) (interface{}, *url.URL, error) {
 	var args HTTPStatusArgs
 	if err := req.UnmarshalArgs(&args); err != nil {
@@ -34,16 +56,85 @@ func (h *Health) HTTPStatus(req *acomm.Request) (interface{}, *url.URL, error) {
 		args.StatusCode = http.StatusOK
 	}
 
+	var bodyRegex *regexp.Regexp
+	if args.BodyRegex != "" {
+		var err error
+		bodyRegex, err = regexp.Compile(args.BodyRegex)
+		if err != nil {
+			return nil, nil, errors.Wrapv(err, map[string]interface{}{"bodyRegex": args.BodyRegex})
+		}
+	}
+
+	client, err := args.httpClient()
+	if err != nil {
+		return nil, nil, err
+	}
+
 	httpReq, err := http.NewRequest(args.Method, args.URL, bytes.NewReader(args.Body))
-	httpResp, err := http.DefaultClient.Do(httpReq)
+	if err != nil {
+		return nil, nil, errors.Wrapv(err, map[string]interface{}{"args": args})
+	}
+	for key, value := range args.Headers {
+		httpReq.Header.Set(key, value)
+	}
+
+	httpResp, err := client.Do(httpReq)
 	if err != nil {
 		return nil, nil, errors.Wrapv(err, map[string]interface{}{"args": args})
 	}
 	defer logrusx.LogReturnedErr(httpResp.Body.Close, nil, "failed to close resp body")
 
 	if httpResp.StatusCode != args.StatusCode {
-		err = errors.Newv("unexpected response status code", map[string]interface{}{"expectedStatusCode": args.StatusCode, "statusCode": httpResp.StatusCode})
+		return nil, nil, errors.Newv("unexpected response status code", map[string]interface{}{"expectedStatusCode": args.StatusCode, "statusCode": httpResp.StatusCode})
+	}
+
+	if bodyRegex != nil {
+		body, err := ioutil.ReadAll(httpResp.Body)
+		if err != nil {
+			return nil, nil, errors.Wrapv(err, map[string]interface{}{"args": args})
+		}
+		if !bodyRegex.Match(body) {
+			return nil, nil, errors.Newv("response body did not match bodyRegex", map[string]interface{}{"bodyRegex": args.BodyRegex})
+		}
+	}
+
+	return nil, nil, nil
+}
+
+// httpClient builds an *http.Client honoring the TLS and redirect options
+// in args, instead of relying on http.DefaultClient.
+func (a HTTPStatusArgs) httpClient() (*http.Client, error) {
+	client := &http.Client{
+		Timeout: a.TimeoutOrDefault(defaultProbeTimeout),
+	}
+
+	if a.DisableRedirects {
+		client.CheckRedirect = func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		}
+	}
+
+	if a.SkipVerify || a.CABundle != "" || a.ClientCert != "" {
+		tlsConfig := &tls.Config{InsecureSkipVerify: a.SkipVerify}
+
+		if a.CABundle != "" {
+			pool := x509.NewCertPool()
+			if !pool.AppendCertsFromPEM([]byte(a.CABundle)) {
+				return nil, errors.Newv("invalid caBundle", map[string]interface{}{"args": a})
+			}
+			tlsConfig.RootCAs = pool
+		}
+
+		if a.ClientCert != "" {
+			cert, err := tls.X509KeyPair([]byte(a.ClientCert), []byte(a.ClientKey))
+			if err != nil {
+				return nil, errors.Wrapv(err, map[string]interface{}{"args": a})
+			}
+			tlsConfig.Certificates = []tls.Certificate{cert}
+		}
+
+		client.Transport = &http.Transport{TLSClientConfig: tlsConfig}
 	}
 
-	return nil, nil, err
+	return client, nil
 }
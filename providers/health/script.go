@@ -0,0 +1,44 @@
+package health
+
+import (
+	"context"
+	"net/url"
+	"os/exec"
+
+	"github.com/cerana/cerana/acomm"
+	"github.com/cerana/cerana/pkg/errors"
+)
+
+func init() {
+	RegisterProbe("health-script", (*Health).Script)
+}
+
+// ScriptArgs are arguments for Script health checks.
+type ScriptArgs struct {
+	Envelope
+
+	Command string   `json:"command"`
+	Args    []string `json:"args"`
+}
+
+// Script succeeds if running Command exits zero within the configured
+// timeout.
+func (h *Health) Script(req *acomm.Request) (interface{}, *url.URL, error) {
+	var args ScriptArgs
+	if err := req.UnmarshalArgs(&args); err != nil {
+		return nil, nil, err
+	}
+
+	if args.Command == "" {
+		return nil, nil, errors.Newv("missing arg: command", map[string]interface{}{"args": args, "missing": "command"})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), args.TimeoutOrDefault(defaultProbeTimeout))
+	defer cancel()
+
+	if err := exec.CommandContext(ctx, args.Command, args.Args...).Run(); err != nil {
+		return nil, nil, errors.Wrapv(err, map[string]interface{}{"args": args})
+	}
+
+	return nil, nil, nil
+}
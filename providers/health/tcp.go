@@ -0,0 +1,41 @@
+package health
+
+import (
+	"net"
+	"net/url"
+
+	"github.com/cerana/cerana/acomm"
+	"github.com/cerana/cerana/pkg/errors"
+)
+
+func init() {
+	RegisterProbe("health-tcp", (*Health).TCPConnect)
+}
+
+// TCPConnectArgs are arguments for TCPConnect health checks.
+type TCPConnectArgs struct {
+	Envelope
+
+	Address string `json:"address"`
+}
+
+// TCPConnect succeeds if a TCP connection can be opened to the address
+// within the configured timeout.
+func (h *Health) TCPConnect(req *acomm.Request) (interface{}, *url.URL, error) {
+	var args TCPConnectArgs
+	if err := req.UnmarshalArgs(&args); err != nil {
+		return nil, nil, err
+	}
+
+	if args.Address == "" {
+		return nil, nil, errors.Newv("missing arg: address", map[string]interface{}{"args": args, "missing": "address"})
+	}
+
+	conn, err := net.DialTimeout("tcp", args.Address, args.TimeoutOrDefault(defaultProbeTimeout))
+	if err != nil {
+		return nil, nil, errors.Wrapv(err, map[string]interface{}{"args": args})
+	}
+	_ = conn.Close()
+
+	return nil, nil, nil
+}
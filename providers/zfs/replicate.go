@@ -0,0 +1,309 @@
+package zfs
+
+import (
+	"context"
+	"net"
+	"net/url"
+	"time"
+
+	"github.com/cerana/cerana/acomm"
+	"github.com/cerana/cerana/pkg/errors"
+	libzfs "github.com/cerana/cerana/zfs"
+)
+
+// replicateDispatchTimeout bounds how long Replicate waits for the source
+// coordinator to acknowledge dispatch of the zfs-send task before giving
+// up on the replication.
+const replicateDispatchTimeout = 30 * time.Second
+
+// replicateAcceptTimeout bounds how long Replicate waits for the source
+// to connect and start streaming once zfs-send has been dispatched.
+const replicateAcceptTimeout = 5 * time.Minute
+
+// SendArgs are arguments for the zfs-send task.
+type SendArgs struct {
+	Dataset      string `json:"dataset"`
+	BaseSnapshot string `json:"baseSnapshot"`
+	Destination  string `json:"destination"`
+
+	Recursive     bool `json:"recursive"`    // -R
+	IntermediaryI bool `json:"intermediary"` // -I, send all intermediary snapshots since BaseSnapshot
+	LargeBlocks   bool `json:"largeBlocks"`  // -L
+	Embedded      bool `json:"embedded"`     // -e
+	Compressed    bool `json:"compressed"`   // -c
+
+	ResumeToken    string `json:"resumeToken"`
+	BandwidthLimit int64  `json:"bandwidthLimit"` // bytes/sec, 0 = unlimited
+}
+
+// Send streams Dataset (optionally incremental from BaseSnapshot) to
+// Destination -- another coordinator's zfs-receive socket, or a raw
+// socket -- and returns an Operation reporting progress in bytes sent. On
+// failure, the operation's metadata carries a resumeToken the caller can
+// pass back in a retried SendArgs to resume where the stream left off.
+func (z *ZFS) Send(req *acomm.Request) (interface{}, *url.URL, error) {
+	var args SendArgs
+	if err := req.UnmarshalArgs(&args); err != nil {
+		return nil, nil, err
+	}
+	if args.Dataset == "" {
+		return nil, nil, errors.Newv("missing arg: dataset", map[string]interface{}{"args": args, "missing": "dataset"})
+	}
+	if args.Destination == "" {
+		return nil, nil, errors.Newv("missing arg: destination", map[string]interface{}{"args": args, "missing": "destination"})
+	}
+
+	dest, err := url.Parse(args.Destination)
+	if err != nil {
+		return nil, nil, errors.Wrapv(err, map[string]interface{}{"args": args})
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	op := z.ops.New(cancel)
+
+	go func() {
+		defer cancel()
+		op.Running()
+
+		conn, err := net.Dial(dest.Scheme, dest.Host+dest.Path)
+		if err != nil {
+			op.Fail(errors.Wrapv(err, map[string]interface{}{"destination": args.Destination}))
+			return
+		}
+		defer func() { _ = conn.Close() }()
+
+		w := throttledWriter(conn, args.BandwidthLimit)
+		sent, resumeToken, err := libzfs.Send(ctx, w, libzfs.SendOptions{
+			Dataset:       args.Dataset,
+			BaseSnapshot:  args.BaseSnapshot,
+			Recursive:     args.Recursive,
+			Intermediary:  args.IntermediaryI,
+			LargeBlocks:   args.LargeBlocks,
+			Embedded:      args.Embedded,
+			Compressed:    args.Compressed,
+			ResumeToken:   args.ResumeToken,
+			ProgressEvery: time.Second,
+			OnProgress: func(bytesSent int64) {
+				op.Progress(map[string]interface{}{"bytesSent": bytesSent})
+			},
+		})
+		if err != nil {
+			op.Progress(map[string]interface{}{"resumeToken": resumeToken})
+			op.Fail(errors.Wrapv(err, map[string]interface{}{"args": args}))
+			return
+		}
+
+		op.Succeed(map[string]interface{}{"bytesSent": sent})
+	}()
+
+	return op.Snapshot(), nil, nil
+}
+
+// ReceiveArgs are arguments for the zfs-receive task.
+type ReceiveArgs struct {
+	Dataset        string `json:"dataset"`
+	Listen         string `json:"listen"` // address to accept the incoming stream on, e.g. "tcp://0.0.0.0:0"
+	Force          bool   `json:"force"`
+	BandwidthLimit int64  `json:"bandwidthLimit"` // bytes/sec, 0 = unlimited
+}
+
+// Receive listens for a single incoming stream and pipes it directly into
+// libzfs, without staging it on disk, and returns an Operation reporting
+// progress in bytes received.
+func (z *ZFS) Receive(req *acomm.Request) (interface{}, *url.URL, error) {
+	var args ReceiveArgs
+	if err := req.UnmarshalArgs(&args); err != nil {
+		return nil, nil, err
+	}
+	if args.Dataset == "" {
+		return nil, nil, errors.Newv("missing arg: dataset", map[string]interface{}{"args": args, "missing": "dataset"})
+	}
+	if args.Listen == "" {
+		return nil, nil, errors.Newv("missing arg: listen", map[string]interface{}{"args": args, "missing": "listen"})
+	}
+
+	listenURL, err := url.Parse(args.Listen)
+	if err != nil {
+		return nil, nil, errors.Wrapv(err, map[string]interface{}{"args": args})
+	}
+
+	listener, err := net.Listen(listenURL.Scheme, listenURL.Host+listenURL.Path)
+	if err != nil {
+		return nil, nil, errors.Wrapv(err, map[string]interface{}{"args": args})
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	op := z.ops.New(func() {
+		cancel()
+		_ = listener.Close()
+	})
+	op.Progress(map[string]interface{}{"listenAddr": listener.Addr().String()})
+
+	go func() {
+		defer cancel()
+		defer func() { _ = listener.Close() }()
+
+		conn, err := listener.Accept()
+		if err != nil {
+			op.Fail(errors.Wrapv(err, map[string]interface{}{"args": args}))
+			return
+		}
+		defer func() { _ = conn.Close() }()
+
+		op.Running()
+		r := throttledReader(conn, args.BandwidthLimit)
+		received, err := libzfs.Receive(ctx, r, args.Dataset, libzfs.ReceiveOptions{
+			Force:         args.Force,
+			ProgressEvery: time.Second,
+			OnProgress: func(bytesReceived int64) {
+				op.Progress(map[string]interface{}{"bytesReceived": bytesReceived})
+			},
+		})
+		if err != nil {
+			op.Fail(errors.Wrapv(err, map[string]interface{}{"args": args}))
+			return
+		}
+
+		op.Succeed(map[string]interface{}{"bytesReceived": received, "dataset": args.Dataset})
+	}()
+
+	return op.Snapshot(), nil, nil
+}
+
+// ReplicateArgs are arguments for the zfs-replicate task.
+type ReplicateArgs struct {
+	SourceDataset string `json:"sourceDataset"`
+	BaseSnapshot  string `json:"baseSnapshot"`
+	SourceURL     string `json:"sourceUrl"` // coordinator that owns SourceDataset
+
+	DestinationDataset string `json:"destinationDataset"`
+
+	Recursive      bool   `json:"recursive"`
+	Incremental    bool   `json:"incremental"`
+	LargeBlocks    bool   `json:"largeBlocks"`
+	Embedded       bool   `json:"embedded"`
+	Compressed     bool   `json:"compressed"`
+	ResumeToken    string `json:"resumeToken"`
+	BandwidthLimit int64  `json:"bandwidthLimit"`
+}
+
+// Replicate performs a pull-based replication of SourceDataset from
+// SourceURL into DestinationDataset on the local host: it opens a local
+// socket to receive the stream, then asks the source coordinator's
+// zfs-send task to push into it. It returns an Operation that tracks the
+// local zfs-receive, since that's what determines when the replica is
+// actually usable.
+func (z *ZFS) Replicate(req *acomm.Request) (interface{}, *url.URL, error) {
+	var args ReplicateArgs
+	if err := req.UnmarshalArgs(&args); err != nil {
+		return nil, nil, err
+	}
+	if args.SourceDataset == "" {
+		return nil, nil, errors.Newv("missing arg: sourceDataset", map[string]interface{}{"args": args, "missing": "sourceDataset"})
+	}
+	if args.SourceURL == "" {
+		return nil, nil, errors.Newv("missing arg: sourceUrl", map[string]interface{}{"args": args, "missing": "sourceUrl"})
+	}
+	if args.DestinationDataset == "" {
+		return nil, nil, errors.Newv("missing arg: destinationDataset", map[string]interface{}{"args": args, "missing": "destinationDataset"})
+	}
+
+	listener, err := net.Listen("tcp", "0.0.0.0:0")
+	if err != nil {
+		return nil, nil, errors.Wrapv(err, map[string]interface{}{"args": args})
+	}
+
+	sourceURL, err := url.Parse(args.SourceURL)
+	if err != nil {
+		_ = listener.Close()
+		return nil, nil, errors.Wrapv(err, map[string]interface{}{"args": args})
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	op := z.ops.New(func() {
+		cancel()
+		_ = listener.Close()
+	})
+
+	go func() {
+		defer cancel()
+		defer func() { _ = listener.Close() }()
+
+		sendAcked := make(chan *acomm.Response, 1)
+		sendHandler := func(_ *acomm.Request, resp *acomm.Response) { sendAcked <- resp }
+
+		sendReq, err := acomm.NewRequest(acomm.RequestOptions{
+			Task:           "zfs-send",
+			TaskURL:        sourceURL,
+			ResponseHook:   z.tracker.URL(),
+			SuccessHandler: sendHandler,
+			ErrorHandler:   sendHandler,
+			Args: SendArgs{
+				Dataset:        args.SourceDataset,
+				BaseSnapshot:   args.BaseSnapshot,
+				Destination:    "tcp://" + listener.Addr().String(),
+				Recursive:      args.Recursive,
+				IntermediaryI:  args.Incremental,
+				LargeBlocks:    args.LargeBlocks,
+				Embedded:       args.Embedded,
+				Compressed:     args.Compressed,
+				ResumeToken:    args.ResumeToken,
+				BandwidthLimit: args.BandwidthLimit,
+			},
+		})
+		if err != nil {
+			op.Fail(err)
+			return
+		}
+		if err := z.tracker.TrackRequest(sendReq, replicateDispatchTimeout); err != nil {
+			op.Fail(errors.Wrapv(err, map[string]interface{}{"args": args}))
+			return
+		}
+		if err := acomm.Send(sourceURL, sendReq); err != nil {
+			op.Fail(errors.Wrapv(err, map[string]interface{}{"args": args}))
+			return
+		}
+
+		// Wait for the source coordinator to acknowledge the zfs-send
+		// dispatch before accepting, so a rejection (bad args, task not
+		// found, etc.) fails the Operation instead of leaving it to hang
+		// in Accept forever.
+		select {
+		case resp := <-sendAcked:
+			if resp.Error != nil {
+				op.Fail(errors.Wrapv(resp.Error, map[string]interface{}{"args": args}))
+				return
+			}
+		case <-time.After(replicateDispatchTimeout):
+			op.Fail(errors.Newv("timed out waiting for zfs-send dispatch ack", map[string]interface{}{"args": args}))
+			return
+		}
+
+		if tcpListener, ok := listener.(*net.TCPListener); ok {
+			_ = tcpListener.SetDeadline(time.Now().Add(replicateAcceptTimeout))
+		}
+		conn, err := listener.Accept()
+		if err != nil {
+			op.Fail(errors.Wrapv(err, map[string]interface{}{"args": args}))
+			return
+		}
+		defer func() { _ = conn.Close() }()
+
+		op.Running()
+		r := throttledReader(conn, args.BandwidthLimit)
+		received, err := libzfs.Receive(ctx, r, args.DestinationDataset, libzfs.ReceiveOptions{
+			ProgressEvery: time.Second,
+			OnProgress: func(bytesReceived int64) {
+				op.Progress(map[string]interface{}{"bytesReceived": bytesReceived})
+			},
+		})
+		if err != nil {
+			op.Fail(errors.Wrapv(err, map[string]interface{}{"args": args}))
+			return
+		}
+
+		op.Succeed(map[string]interface{}{"bytesReceived": received, "dataset": args.DestinationDataset})
+	}()
+
+	return op.Snapshot(), nil, nil
+}
@@ -0,0 +1,72 @@
+package zfs
+
+import (
+	"io"
+	"time"
+)
+
+// throttledWriter wraps w so writes are paced to limitBytesPerSec bytes per
+// second. A limit of 0 disables throttling.
+func throttledWriter(w io.Writer, limitBytesPerSec int64) io.Writer {
+	if limitBytesPerSec <= 0 {
+		return w
+	}
+	return &rateLimitedWriter{w: w, limit: limitBytesPerSec}
+}
+
+type rateLimitedWriter struct {
+	w           io.Writer
+	limit       int64
+	written     int64
+	windowStart time.Time
+}
+
+func (r *rateLimitedWriter) Write(p []byte) (int, error) {
+	if r.windowStart.IsZero() {
+		r.windowStart = time.Now()
+	}
+
+	n, err := r.w.Write(p)
+	r.written += int64(n)
+
+	elapsed := time.Since(r.windowStart)
+	expected := time.Duration(float64(r.written) / float64(r.limit) * float64(time.Second))
+	if expected > elapsed {
+		time.Sleep(expected - elapsed)
+	}
+
+	return n, err
+}
+
+// throttledReader wraps r so reads are paced to limitBytesPerSec bytes per
+// second. A limit of 0 disables throttling.
+func throttledReader(r io.Reader, limitBytesPerSec int64) io.Reader {
+	if limitBytesPerSec <= 0 {
+		return r
+	}
+	return &rateLimitedReader{r: r, limit: limitBytesPerSec}
+}
+
+type rateLimitedReader struct {
+	r           io.Reader
+	limit       int64
+	read        int64
+	windowStart time.Time
+}
+
+func (r *rateLimitedReader) Read(p []byte) (int, error) {
+	if r.windowStart.IsZero() {
+		r.windowStart = time.Now()
+	}
+
+	n, err := r.r.Read(p)
+	r.read += int64(n)
+
+	elapsed := time.Since(r.windowStart)
+	expected := time.Duration(float64(r.read) / float64(r.limit) * float64(time.Second))
+	if expected > elapsed {
+		time.Sleep(expected - elapsed)
+	}
+
+	return n, err
+}
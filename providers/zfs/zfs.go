@@ -0,0 +1,246 @@
+// Package zfs provides an acomm provider for local ZFS dataset and pool
+// operations.
+package zfs
+
+import (
+	"context"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/cerana/cerana/acomm"
+	"github.com/cerana/cerana/pkg/errors"
+	"github.com/cerana/cerana/provider"
+	libzfs "github.com/cerana/cerana/zfs"
+)
+
+// TaskFunc is the signature of a single acomm task handler.
+type TaskFunc func(*acomm.Request) (interface{}, *url.URL, error)
+
+// MetricsRecorder records per-task timing for the provider's tasks.
+type MetricsRecorder interface {
+	RecordTask(task string, duration time.Duration, err error)
+}
+
+// HealthChecker lets an integrator swap in a custom readiness check for the
+// ZFS provider instead of assuming the local zpool/zfs binaries.
+type HealthChecker interface {
+	Healthy() error
+}
+
+// ZFS is a provider of ZFS dataset and pool management tasks.
+type ZFS struct {
+	config        *provider.Config
+	tracker       *acomm.Tracker
+	ops           *acomm.OperationManager
+	tasks         map[string]TaskFunc
+	metrics       MetricsRecorder
+	logger        *logrus.Entry
+	healthChecker HealthChecker
+}
+
+// Option configures a ZFS provider constructed with New.
+type Option func(*ZFS)
+
+// WithConfig sets the provider's config.
+func WithConfig(config *provider.Config) Option {
+	return func(z *ZFS) { z.config = config }
+}
+
+// WithTracker sets the provider's request tracker.
+func WithTracker(tracker *acomm.Tracker) Option {
+	return func(z *ZFS) { z.tracker = tracker }
+}
+
+// WithTaskMap overrides the provider's default task -> handler mapping.
+// Callers can start from New(...).Tasks(), mutate it, and pass it back in,
+// which is how a mock ZFS backend gets substituted for tests.
+func WithTaskMap(tasks map[string]TaskFunc) Option {
+	return func(z *ZFS) { z.tasks = tasks }
+}
+
+// WithMetrics sets a recorder that's called with the duration and error of
+// every task handled by this provider.
+func WithMetrics(metrics MetricsRecorder) Option {
+	return func(z *ZFS) { z.metrics = metrics }
+}
+
+// WithLogger sets the provider's logger.
+func WithLogger(logger *logrus.Entry) Option {
+	return func(z *ZFS) { z.logger = logger }
+}
+
+// WithHealthChecker overrides how the provider determines its own
+// readiness.
+func WithHealthChecker(checker HealthChecker) Option {
+	return func(z *ZFS) { z.healthChecker = checker }
+}
+
+// Dataset describes a ZFS dataset and its properties.
+type Dataset struct {
+	Name       string                    `json:"name"`
+	Properties *libzfs.DatasetProperties `json:"properties"`
+}
+
+// Mountpoint returns the dataset's effective mountpoint, accounting for
+// datasets that inherit it from an ancestor.
+func (d *Dataset) Mountpoint() string {
+	if d.Properties == nil || d.Properties.MountpointSource == "" {
+		return d.Name
+	}
+	return d.Properties.Mountpoint + strings.TrimPrefix(d.Name, d.Properties.MountpointSource)
+}
+
+// New creates a new ZFS provider. Without WithTaskMap, it registers its own
+// default tasks; passing WithTaskMap lets a caller override or extend that
+// set before RegisterTasks runs, e.g. to swap in a mock ZFS backend for
+// tests.
+func New(opts ...Option) *ZFS {
+	z := &ZFS{}
+	for _, opt := range opts {
+		opt(z)
+	}
+
+	// A Tracker persists Operations alongside its own tracked requests, so
+	// a coordinator restart doesn't lose track of in-flight work; without
+	// one, Operations are only tracked in memory.
+	var store acomm.OperationStore
+	if z.tracker != nil {
+		if s, err := acomm.NewTrackerStore(z.tracker); err == nil {
+			store = s
+		} else if z.logger != nil {
+			z.logger.WithError(err).Warn("failed to set up persistent operation store")
+		}
+	}
+	ops, _ := acomm.NewOperationManager(store)
+	z.ops = ops
+
+	if z.tasks == nil {
+		z.tasks = z.defaultTasks()
+	}
+	return z
+}
+
+// Tasks returns a copy of the provider's current task -> handler mapping --
+// the default set, or whatever WithTaskMap supplied. It's the starting
+// point WithTaskMap's doc comment refers to: take New(...).Tasks(), replace
+// or remove entries, and pass the result back in via WithTaskMap to swap in
+// a mock backend for a subset of tasks without losing the rest.
+func (z *ZFS) Tasks() map[string]TaskFunc {
+	tasks := make(map[string]TaskFunc, len(z.tasks))
+	for name, fn := range z.tasks {
+		tasks[name] = fn
+	}
+	return tasks
+}
+
+// defaultTasks returns the provider's built-in task -> handler mapping.
+func (z *ZFS) defaultTasks() map[string]TaskFunc {
+	return map[string]TaskFunc{
+		"zpool-scrub":   z.ScrubPool,
+		"zfs-clone":     z.Clone,
+		"zfs-send":      z.Send,
+		"zfs-receive":   z.Receive,
+		"zfs-replicate": z.Replicate,
+	}
+}
+
+// RegisterTasks registers the provider's task map with the server.
+func (z *ZFS) RegisterTasks(server *provider.Server) {
+	for name, fn := range z.tasks {
+		server.RegisterTask(name, z.instrument(name, fn))
+	}
+	acomm.RegisterOperationTasks(server, z.ops)
+}
+
+// instrument wraps fn with metrics recording, if WithMetrics was used.
+func (z *ZFS) instrument(name string, fn TaskFunc) TaskFunc {
+	if z.metrics == nil {
+		return fn
+	}
+	return func(req *acomm.Request) (interface{}, *url.URL, error) {
+		start := time.Now()
+		result, respURL, err := fn(req)
+		z.metrics.RecordTask(name, time.Since(start), err)
+		return result, respURL, err
+	}
+}
+
+// Healthy reports whether the provider is ready to serve tasks. It defers
+// to a HealthChecker set via WithHealthChecker, if any.
+func (z *ZFS) Healthy() error {
+	if z.healthChecker == nil {
+		return nil
+	}
+	return z.healthChecker.Healthy()
+}
+
+// ScrubArgs are arguments for the zpool-scrub task.
+type ScrubArgs struct {
+	Pool string `json:"pool"`
+}
+
+// ScrubPool starts a zpool scrub and returns an Operation handle rather
+// than blocking the task response until the scrub finishes; the caller can
+// poll progress or cancel it via the operation-wait/-get/-cancel tasks.
+func (z *ZFS) ScrubPool(req *acomm.Request) (interface{}, *url.URL, error) {
+	var args ScrubArgs
+	if err := req.UnmarshalArgs(&args); err != nil {
+		return nil, nil, err
+	}
+	if args.Pool == "" {
+		return nil, nil, errors.Newv("missing arg: pool", map[string]interface{}{"args": args, "missing": "pool"})
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	op := z.ops.New(cancel)
+
+	go func() {
+		defer cancel()
+		op.Running()
+		if err := libzfs.ScrubPool(ctx, args.Pool); err != nil {
+			op.Fail(err)
+			return
+		}
+		op.Succeed(nil)
+	}()
+
+	return op.Snapshot(), nil, nil
+}
+
+// CloneArgs are arguments for the zfs-clone task.
+type CloneArgs struct {
+	Snapshot    string `json:"snapshot"`
+	Destination string `json:"destination"`
+}
+
+// Clone clones Snapshot to Destination and returns an Operation handle,
+// since cloning a large dataset can take a while to settle.
+func (z *ZFS) Clone(req *acomm.Request) (interface{}, *url.URL, error) {
+	var args CloneArgs
+	if err := req.UnmarshalArgs(&args); err != nil {
+		return nil, nil, err
+	}
+	if args.Snapshot == "" {
+		return nil, nil, errors.Newv("missing arg: snapshot", map[string]interface{}{"args": args, "missing": "snapshot"})
+	}
+	if args.Destination == "" {
+		return nil, nil, errors.Newv("missing arg: destination", map[string]interface{}{"args": args, "missing": "destination"})
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	op := z.ops.New(cancel)
+
+	go func() {
+		defer cancel()
+		op.Running()
+		if err := libzfs.Clone(ctx, args.Snapshot, args.Destination); err != nil {
+			op.Fail(err)
+			return
+		}
+		op.Succeed(&Dataset{Name: args.Destination})
+	}()
+
+	return op.Snapshot(), nil, nil
+}
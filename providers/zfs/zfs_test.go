@@ -165,7 +165,7 @@ func (s *zfs) SetupSuite() {
 	s.Require().NoError(tracker.Start())
 	s.tracker = tracker
 
-	s.zfs = zfsp.New(config, tracker)
+	s.zfs = zfsp.New(zfsp.WithConfig(config), zfsp.WithTracker(tracker))
 }
 
 func (s *zfs) SetupTest() {
@@ -215,3 +215,36 @@ func (s *zfs) TestRegisterTasks() {
 
 	s.True(len(server.RegisteredTasks()) > 0)
 }
+
+// TestWithTaskMapOverridesDefaultTasks exercises WithTaskMap with a mock
+// "zfs-send" handler, the way an integrator swaps in a mock backend to
+// avoid exercising libzfs/real zpool -- and, by extension, sudo -- for
+// tests that don't care about the real dataset behavior.
+func (s *zfs) TestWithTaskMapOverridesDefaultTasks() {
+	tasks := zfsp.New().Tasks()
+
+	var called bool
+	tasks["zfs-send"] = func(req *acomm.Request) (interface{}, *url.URL, error) {
+		called = true
+		return "mocked", nil, nil
+	}
+	delete(tasks, "zfs-receive")
+
+	mock := zfsp.New(zfsp.WithConfig(s.config), zfsp.WithTracker(s.tracker), zfsp.WithTaskMap(tasks))
+
+	server, err := provider.NewServer(s.config)
+	s.Require().NoError(err)
+	mock.RegisterTasks(server)
+
+	registered := server.RegisteredTasks()
+	s.Contains(registered, "zfs-send")
+	s.NotContains(registered, "zfs-receive")
+
+	req, err := acomm.NewRequest(acomm.RequestOptions{Task: "zfs-send"})
+	s.Require().NoError(err)
+
+	result, _, err := mock.Tasks()["zfs-send"](req)
+	s.Require().NoError(err)
+	s.Equal("mocked", result)
+	s.True(called)
+}
@@ -0,0 +1,43 @@
+package zfs
+
+import (
+	"io"
+	"time"
+)
+
+// copyWithProgress copies from src to dst, calling onProgress with the
+// running total no more often than every, plus once more when src is
+// exhausted.
+func copyWithProgress(dst io.Writer, src io.Reader, every time.Duration, onProgress func(int64)) (int64, error) {
+	if every <= 0 {
+		every = time.Second
+	}
+
+	var total int64
+	buf := make([]byte, 32*1024)
+	last := time.Now()
+
+	for {
+		n, readErr := src.Read(buf)
+		if n > 0 {
+			written, writeErr := dst.Write(buf[:n])
+			total += int64(written)
+			if writeErr != nil {
+				return total, writeErr
+			}
+			if onProgress != nil && time.Since(last) >= every {
+				onProgress(total)
+				last = time.Now()
+			}
+		}
+		if readErr != nil {
+			if readErr == io.EOF {
+				if onProgress != nil {
+					onProgress(total)
+				}
+				return total, nil
+			}
+			return total, readErr
+		}
+	}
+}
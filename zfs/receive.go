@@ -0,0 +1,58 @@
+package zfs
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os/exec"
+	"time"
+
+	"github.com/cerana/cerana/pkg/errors"
+)
+
+// ReceiveOptions configure Receive.
+type ReceiveOptions struct {
+	Force bool // -F, roll back the destination to receive an incremental stream
+
+	ProgressEvery time.Duration
+	OnProgress    func(bytesReceived int64)
+}
+
+// receiveArgs builds the zfs(8) receive argument list for dataset/opts.
+func receiveArgs(dataset string, opts ReceiveOptions) []string {
+	args := []string{"receive"}
+	if opts.Force {
+		args = append(args, "-F")
+	}
+	return append(args, dataset)
+}
+
+// Receive pipes r directly into "zfs receive" for dataset -- without
+// staging the stream on disk -- and returns the number of bytes received.
+func Receive(ctx context.Context, r io.Reader, dataset string, opts ReceiveOptions) (int64, error) {
+	cmd := exec.CommandContext(ctx, "zfs", receiveArgs(dataset, opts)...)
+
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return 0, errors.Wrapv(err, map[string]interface{}{"dataset": dataset})
+	}
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+
+	if err := cmd.Start(); err != nil {
+		return 0, errors.Wrapv(err, map[string]interface{}{"dataset": dataset})
+	}
+
+	received, copyErr := copyWithProgress(stdin, r, opts.ProgressEvery, opts.OnProgress)
+	_ = stdin.Close()
+	waitErr := cmd.Wait()
+
+	if copyErr != nil || waitErr != nil {
+		err := copyErr
+		if err == nil {
+			err = waitErr
+		}
+		return received, errors.Wrapv(err, map[string]interface{}{"dataset": dataset, "stderr": stderr.String()})
+	}
+	return received, nil
+}
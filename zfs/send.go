@@ -0,0 +1,142 @@
+package zfs
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"io"
+	"os/exec"
+	"regexp"
+	"sync"
+	"time"
+
+	"github.com/cerana/cerana/pkg/errors"
+)
+
+// SendOptions configure Send.
+type SendOptions struct {
+	Dataset      string
+	BaseSnapshot string
+	Recursive    bool // -R
+	Intermediary bool // -I, send every intermediary snapshot since BaseSnapshot, not just the delta
+	LargeBlocks  bool // -L
+	Embedded     bool // -e
+	Compressed   bool // -c
+
+	// ResumeToken, if set, resumes a previously interrupted send from the
+	// last snapshot it fully sent (as returned by a prior Send call): it
+	// takes the place of BaseSnapshot and forces an intermediary (-I) send
+	// up to Dataset.
+	ResumeToken string
+
+	ProgressEvery time.Duration
+	OnProgress    func(bytesSent int64)
+}
+
+// sendArgs builds the zfs(8) send argument list for opts.
+func sendArgs(opts SendOptions) []string {
+	base := opts.BaseSnapshot
+	intermediary := opts.Intermediary
+	if opts.ResumeToken != "" {
+		base = opts.ResumeToken
+		intermediary = true
+	}
+
+	args := []string{"send", "-v"}
+	if opts.Recursive {
+		args = append(args, "-R")
+	}
+	if opts.LargeBlocks {
+		args = append(args, "-L")
+	}
+	if opts.Embedded {
+		args = append(args, "-e")
+	}
+	if opts.Compressed {
+		args = append(args, "-c")
+	}
+	if base != "" {
+		flag := "-i"
+		if intermediary {
+			flag = "-I"
+		}
+		args = append(args, flag, base)
+	}
+	return append(args, opts.Dataset)
+}
+
+// sendProgressRe matches the snapshot-reporting lines zfs send -v writes
+// to stderr as it works through a stream: "send from @a to pool/fs@b ..."
+// for an incremental, or "full send of pool/fs@a ..." for the first
+// snapshot in a stream.
+var sendProgressRe = regexp.MustCompile(`\b(?:to|of)\s+(\S+)`)
+
+// parseSendProgressLine returns the snapshot name out of a zfs send -v
+// progress line, or "" if the line doesn't report one.
+func parseSendProgressLine(line string) string {
+	m := sendProgressRe.FindStringSubmatch(line)
+	if m == nil {
+		return ""
+	}
+	return m[1]
+}
+
+// Send streams opts.Dataset (or resumes from opts.ResumeToken) to w via
+// "zfs send", reporting progress at opts.ProgressEvery. If the stream is
+// interrupted partway through a multi-snapshot (-I) send, the returned
+// resumeToken is the last snapshot that was fully sent -- passing it back
+// as opts.ResumeToken on the next call continues from there instead of
+// resending everything.
+func Send(ctx context.Context, w io.Writer, opts SendOptions) (int64, string, error) {
+	cmd := exec.CommandContext(ctx, "zfs", sendArgs(opts)...)
+
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return 0, "", errors.Wrapv(err, map[string]interface{}{"dataset": opts.Dataset})
+	}
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		return 0, "", errors.Wrapv(err, map[string]interface{}{"dataset": opts.Dataset})
+	}
+
+	if err := cmd.Start(); err != nil {
+		return 0, "", errors.Wrapv(err, map[string]interface{}{"dataset": opts.Dataset})
+	}
+
+	lastSnapshot := opts.BaseSnapshot
+	if opts.ResumeToken != "" {
+		lastSnapshot = opts.ResumeToken
+	}
+	var stderrBuf bytes.Buffer
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		scanner := bufio.NewScanner(io.TeeReader(stderr, &stderrBuf))
+		// Each progress line names the snapshot being started, so the one
+		// named before it is the last that was fully sent.
+		var current string
+		for scanner.Scan() {
+			if snap := parseSendProgressLine(scanner.Text()); snap != "" {
+				if current != "" {
+					lastSnapshot = current
+				}
+				current = snap
+			}
+		}
+	}()
+
+	sent, copyErr := copyWithProgress(w, stdout, opts.ProgressEvery, opts.OnProgress)
+	wg.Wait()
+	waitErr := cmd.Wait()
+
+	if copyErr != nil || waitErr != nil {
+		err := copyErr
+		if err == nil {
+			err = waitErr
+		}
+		return sent, lastSnapshot, errors.Wrapv(err, map[string]interface{}{"dataset": opts.Dataset, "stderr": stderrBuf.String()})
+	}
+	return sent, "", nil
+}
@@ -0,0 +1,56 @@
+package zfs
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSendArgs(t *testing.T) {
+	tests := []struct {
+		name string
+		opts SendOptions
+		want []string
+	}{
+		{
+			"full send",
+			SendOptions{Dataset: "pool/fs@snap"},
+			[]string{"send", "-v", "pool/fs@snap"},
+		},
+		{
+			"incremental delta",
+			SendOptions{Dataset: "pool/fs@snap2", BaseSnapshot: "pool/fs@snap1"},
+			[]string{"send", "-v", "-i", "pool/fs@snap1", "pool/fs@snap2"},
+		},
+		{
+			"intermediary",
+			SendOptions{Dataset: "pool/fs@snap3", BaseSnapshot: "pool/fs@snap1", Intermediary: true},
+			[]string{"send", "-v", "-I", "pool/fs@snap1", "pool/fs@snap3"},
+		},
+		{
+			"all flags",
+			SendOptions{Dataset: "pool/fs@snap", Recursive: true, LargeBlocks: true, Embedded: true, Compressed: true},
+			[]string{"send", "-v", "-R", "-L", "-e", "-c", "pool/fs@snap"},
+		},
+		{
+			"resume token overrides base snapshot",
+			SendOptions{Dataset: "pool/fs@snap3", BaseSnapshot: "pool/fs@snap1", ResumeToken: "pool/fs@snap2"},
+			[]string{"send", "-v", "-I", "pool/fs@snap2", "pool/fs@snap3"},
+		},
+	}
+
+	for _, test := range tests {
+		assert.Equal(t, test.want, sendArgs(test.opts), test.name)
+	}
+}
+
+func TestParseSendProgressLine(t *testing.T) {
+	assert.Equal(t, "pool/fs@snap2", parseSendProgressLine("send from @snap1 to pool/fs@snap2 estimated size is 10K"))
+	assert.Equal(t, "pool/fs@snap1", parseSendProgressLine("full send of pool/fs@snap1 estimated size is 10K"))
+	assert.Equal(t, "", parseSendProgressLine("TIME        SENT   SNAPSHOT pool/fs@snap1"))
+}
+
+func TestReceiveArgs(t *testing.T) {
+	assert.Equal(t, []string{"receive", "pool/fs"}, receiveArgs("pool/fs", ReceiveOptions{}))
+	assert.Equal(t, []string{"receive", "-F", "pool/fs"}, receiveArgs("pool/fs", ReceiveOptions{Force: true}))
+}
@@ -0,0 +1,72 @@
+// Package zfs wraps the zfs(8)/zpool(8) command line tools for the
+// providers/zfs package: scrubbing pools, cloning snapshots, and streaming
+// datasets in and out via send/receive.
+package zfs
+
+import (
+	"bytes"
+	"context"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/cerana/cerana/pkg/errors"
+)
+
+// DatasetProperties holds the subset of a dataset's zfs properties that
+// providers/zfs needs to compute its effective mountpoint.
+type DatasetProperties struct {
+	MountpointSource string `json:"mountpointSource"`
+	Mountpoint       string `json:"mountpoint"`
+}
+
+// ScrubPool starts a scrub of pool and blocks until it completes or ctx is
+// cancelled, polling zpool status in the meantime.
+func ScrubPool(ctx context.Context, pool string) error {
+	if err := run(ctx, "zpool", "scrub", pool); err != nil {
+		return err
+	}
+	return waitForScrub(ctx, pool)
+}
+
+// waitForScrub polls "zpool status" until pool no longer reports a scrub in
+// progress.
+func waitForScrub(ctx context.Context, pool string) error {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+			var stdout, stderr bytes.Buffer
+			cmd := exec.CommandContext(ctx, "zpool", "status", pool)
+			cmd.Stdout = &stdout
+			cmd.Stderr = &stderr
+			if err := cmd.Run(); err != nil {
+				return errors.Wrapv(err, map[string]interface{}{"pool": pool, "stderr": stderr.String()})
+			}
+			if !strings.Contains(stdout.String(), "scrub in progress") {
+				return nil
+			}
+		}
+	}
+}
+
+// Clone clones snapshot to destination.
+func Clone(ctx context.Context, snapshot, destination string) error {
+	return run(ctx, "zfs", "clone", snapshot, destination)
+}
+
+// run executes name with args, returning the command's stderr wrapped into
+// the error on failure.
+func run(ctx context.Context, name string, args ...string) error {
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return errors.Wrapv(err, map[string]interface{}{"command": append([]string{name}, args...), "stderr": stderr.String()})
+	}
+	return nil
+}